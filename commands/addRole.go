@@ -30,7 +30,7 @@ func AddRoleInteractionCreate(s *discordgo.Session, i *discordgo.InteractionCrea
 			}
 
 			// Verify that the user has permission to add roles
-			if !CheckApprovedRole(s, i.Member) {
+			if !events.HasApproverRole(i.Member) {
 				_, err = s.FollowupMessageCreate(i.Interaction, true, &discordgo.WebhookParams{
 					Content: "You do not have permission to add roles.",
 					Flags:   discordgo.MessageFlagsEphemeral,
@@ -61,47 +61,8 @@ func AddRoleInteractionCreate(s *discordgo.Session, i *discordgo.InteractionCrea
 
 			// Check if the role requires approval
 			rolesRequiringApproval := viper.GetStringSlice("rolesRequiringApproval")
-			approvalRole := viper.GetString("roleApproverId")
 			if contains(rolesRequiringApproval, role.ID) {
-				targetUser = targetMember.User
-				targetUsername := targetMember.User.Username
-				if targetUser.GlobalName != "" {
-					targetUsername = targetUser.GlobalName
-				}
-
-				embed := &discordgo.MessageEmbed{
-					Title:       "Role Request",
-					Description: "<@" + user.ID + "> has requested to add the <@&" + role.ID + "> role to " + "<@" + targetMember.User.ID + ">" + " (" + targetUsername + ")",
-
-					Color: 0x00ff00,
-					Fields: []*discordgo.MessageEmbedField{
-						{
-							Name:   "Approval Role",
-							Value:  "<@&" + approvalRole + ">",
-							Inline: true,
-						},
-					},
-				}
-				_, err = s.ChannelMessageSendComplex(viper.GetString("accessControlChannelId"), &discordgo.MessageSend{
-					Content: "||<@&" + approvalRole + ">||",
-					Embeds:  []*discordgo.MessageEmbed{embed},
-					Components: []discordgo.MessageComponent{
-						discordgo.ActionsRow{
-							Components: []discordgo.MessageComponent{
-								discordgo.Button{
-									Label:    "Approve",
-									Style:    discordgo.PrimaryButton,
-									CustomID: "approve_add_role_" + targetMember.User.ID + "_" + role.ID,
-								},
-								discordgo.Button{
-									Label:    "Deny",
-									Style:    discordgo.DangerButton,
-									CustomID: "deny_add_role_" + targetMember.User.ID + "_" + role.ID,
-								},
-							},
-						},
-					},
-				})
+				err = events.SendRoleApprovalRequest(s, user.ID, targetMember.User, role.ID)
 				if err != nil {
 					log.Println("Error sending approval message to access channel:", err)
 				}
@@ -193,26 +154,3 @@ func contains(slice []string, item string) bool {
 	}
 	return false
 }
-
-func CheckApprovedRole(s *discordgo.Session, m *discordgo.Member) (approved bool) {
-	approvedRoles := viper.GetStringSlice("rolesRequiringApproval")
-	userRoles := m.Roles
-	resultChan := make(chan bool, len(userRoles))
-
-	for _, role := range userRoles {
-		go func(r string) {
-			if contains(approvedRoles, r) {
-				resultChan <- true
-			} else {
-				resultChan <- false
-			}
-		}(role)
-	}
-
-	for range userRoles {
-		if <-resultChan {
-			return true
-		}
-	}
-	return false
-}
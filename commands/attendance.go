@@ -0,0 +1,180 @@
+package commands
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"time"
+
+	"djs-zth-utilities/events"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// attendanceSummary is a member's attendance across several raids
+type attendanceSummary struct {
+	userID   string
+	present  int
+	minutes  int
+	perRaid  map[int]int
+	username string
+}
+
+func Attendance(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	if i.Type != discordgo.InteractionApplicationCommand {
+		return
+	}
+	if i.ApplicationCommandData().Name != "attendance" {
+		return
+	}
+
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Flags: discordgo.MessageFlagsEphemeral,
+		},
+	})
+	if err != nil {
+		log.Println("Error acknowledging interaction:", err)
+		return
+	}
+
+	if !events.HasApproverRole(i.Member) {
+		_, err = s.FollowupMessageCreate(i.Interaction, true, &discordgo.WebhookParams{
+			Content: "You do not have permission to view raid attendance.",
+			Flags:   discordgo.MessageFlagsEphemeral,
+		})
+		if err != nil {
+			log.Println("Error sending follow-up message:", err)
+		}
+		return
+	}
+
+	optionMap := buildOptionMap(i.ApplicationCommandData().Options)
+	team, ok := events.RaidTeamByValue(optionMap["team"].StringValue())
+	if !ok {
+		_, err = s.FollowupMessageCreate(i.Interaction, true, &discordgo.WebhookParams{
+			Content: "Unknown raid team.",
+			Flags:   discordgo.MessageFlagsEphemeral,
+		})
+		if err != nil {
+			log.Println("Error sending follow-up message:", err)
+		}
+		return
+	}
+	days := 30
+	if opt, ok := optionMap["range"]; ok {
+		days = int(opt.IntValue())
+	}
+
+	raids, err := events.RaidAttendanceSince(team.Value, time.Now().AddDate(0, 0, -days))
+	if err != nil {
+		log.Printf("Error reading raid attendance for %s: %v", team.Value, err)
+	}
+	if len(raids) == 0 {
+		_, err = s.FollowupMessageCreate(i.Interaction, true, &discordgo.WebhookParams{
+			Content: fmt.Sprintf("No raids recorded for **%s** in the last %d days.", team.Name, days),
+			Flags:   discordgo.MessageFlagsEphemeral,
+		})
+		if err != nil {
+			log.Println("Error sending follow-up message:", err)
+		}
+		return
+	}
+
+	summaries := make(map[string]*attendanceSummary)
+	for idx, raid := range raids {
+		for _, attendee := range raid.Attendees {
+			summary, exists := summaries[attendee.UserID]
+			if !exists {
+				summary = &attendanceSummary{userID: attendee.UserID, perRaid: make(map[int]int)}
+				if member, found := events.Members().Get(attendee.UserID); found {
+					summary.username = member.User.Username
+				}
+				summaries[attendee.UserID] = summary
+			}
+			summary.perRaid[idx] = attendee.Minutes
+			summary.minutes += attendee.Minutes
+			if raid.Present(attendee) {
+				summary.present++
+			}
+		}
+	}
+	sorted := make([]*attendanceSummary, 0, len(summaries))
+	for _, summary := range summaries {
+		sorted = append(sorted, summary)
+	}
+	sort.Slice(sorted, func(a, b int) bool {
+		if sorted[a].present != sorted[b].present {
+			return sorted[a].present > sorted[b].present
+		}
+		return sorted[a].minutes > sorted[b].minutes
+	})
+
+	var lines []string
+	for _, summary := range sorted {
+		lines = append(lines, fmt.Sprintf("<@%s> %d/%d raids (%d%%)", summary.userID, summary.present, len(raids), summary.present*100/len(raids)))
+	}
+	description := ""
+	for idx, line := range lines {
+		if len(description)+len(line)+40 > 4000 {
+			description += fmt.Sprintf("...and %d more", len(lines)-idx)
+			break
+		}
+		description += line + "\n"
+	}
+
+	embed := &discordgo.MessageEmbed{
+		Title:       fmt.Sprintf("Raid Attendance - %s (last %d days)", team.Name, days),
+		Description: description,
+		Color:       0x9B59B6,
+		Footer: &discordgo.MessageEmbedFooter{
+			Text: fmt.Sprintf("%d raids • full breakdown in the attached CSV", len(raids)),
+		},
+	}
+	_, err = s.FollowupMessageCreate(i.Interaction, true, &discordgo.WebhookParams{
+		Embeds: []*discordgo.MessageEmbed{embed},
+		Files: []*discordgo.File{
+			{
+				Name:        "attendance-" + team.Value + "-" + time.Now().Format("2006-01-02") + ".csv",
+				ContentType: "text/csv",
+				Reader:      attendanceCSV(raids, sorted),
+			},
+		},
+		Flags: discordgo.MessageFlagsEphemeral,
+	})
+	if err != nil {
+		log.Println("Error sending follow-up message:", err)
+	}
+}
+
+// attendanceCSV writes one row per member with their minutes in voice for
+// each raid
+func attendanceCSV(raids []events.RaidAttendance, summaries []*attendanceSummary) *bytes.Buffer {
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+	header := []string{"user_id", "username", "raids_present", "raids_total", "attendance_percent", "total_minutes"}
+	for _, raid := range raids {
+		header = append(header, raid.Start.Format("2006-01-02 15:04"))
+	}
+	writer.Write(header)
+	for _, summary := range summaries {
+		row := []string{
+			summary.userID,
+			summary.username,
+			strconv.Itoa(summary.present),
+			strconv.Itoa(len(raids)),
+			strconv.Itoa(summary.present * 100 / len(raids)),
+			strconv.Itoa(summary.minutes),
+		}
+		for idx := range raids {
+			row = append(row, strconv.Itoa(summary.perRaid[idx]))
+		}
+		writer.Write(row)
+	}
+	writer.Flush()
+	return &buf
+}
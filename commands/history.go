@@ -0,0 +1,165 @@
+package commands
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"djs-zth-utilities/events"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const historyPageSize = 10
+
+var historyKindLabels = map[string]string{
+	events.HistoryJoin:           "📥 Joined",
+	events.HistoryLeave:          "📤 Left",
+	events.HistoryRoleAdded:      "➕ Role Added",
+	events.HistoryRoleRemoved:    "➖ Role Removed",
+	events.HistoryMessageDeleted: "🗑️ Message Deleted",
+	events.HistoryReported:       "🚩 Reported",
+	events.HistoryTicket:         "🎫 Ticket",
+	events.HistoryProfileChange:  "✏️ Profile",
+	events.HistoryTimeout:        "🔇 Timeout",
+	events.HistoryWarning:        "⚠️ Warning",
+	events.HistoryPardon:         "🕊️ Pardon",
+	events.HistoryKick:           "👢 Kicked",
+	events.HistoryBan:            "🔨 Banned",
+}
+
+func History(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	if i.Type != discordgo.InteractionApplicationCommand {
+		return
+	}
+	if i.ApplicationCommandData().Name != "history" {
+		return
+	}
+
+	if !events.HasModeratorRole(i.Member) {
+		err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseChannelMessageWithSource,
+			Data: &discordgo.InteractionResponseData{
+				Content: "You do not have permission to view member history.",
+				Flags:   discordgo.MessageFlagsEphemeral,
+			},
+		})
+		if err != nil {
+			log.Println("Error sending interaction response:", err)
+		}
+		return
+	}
+
+	user := i.ApplicationCommandData().Options[0].UserValue(s)
+	embed, components := historyPage(user.ID, 0)
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Embeds:     []*discordgo.MessageEmbed{embed},
+			Components: components,
+			Flags:      discordgo.MessageFlagsEphemeral,
+		},
+	})
+	if err != nil {
+		log.Println("Error sending interaction response:", err)
+	}
+}
+
+// HistoryPageInteraction handles the previous/next buttons on /history
+func HistoryPageInteraction(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	if i.Type != discordgo.InteractionMessageComponent {
+		return
+	}
+	customID := i.MessageComponentData().CustomID
+	if !strings.HasPrefix(customID, "history_page_") {
+		return
+	}
+	parts := strings.Split(customID, "_")
+	if len(parts) != 4 {
+		return
+	}
+	page, err := strconv.Atoi(parts[3])
+	if err != nil {
+		return
+	}
+
+	embed, components := historyPage(parts[2], page)
+	err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseUpdateMessage,
+		Data: &discordgo.InteractionResponseData{
+			Embeds:     []*discordgo.MessageEmbed{embed},
+			Components: components,
+		},
+	})
+	if err != nil {
+		log.Println("Error sending interaction response:", err)
+	}
+}
+
+// historyPage renders one page of a member's timeline along with the
+// buttons to move between pages
+func historyPage(userID string, page int) (*discordgo.MessageEmbed, []discordgo.MessageComponent) {
+	entries, err := events.MemberHistory(userID)
+	if err != nil {
+		log.Printf("Error reading history for %s: %v", userID, err)
+	}
+
+	pages := (len(entries) + historyPageSize - 1) / historyPageSize
+	if pages == 0 {
+		pages = 1
+	}
+	if page < 0 {
+		page = 0
+	}
+	if page >= pages {
+		page = pages - 1
+	}
+
+	embed := &discordgo.MessageEmbed{
+		Title:  "Member History",
+		Color:  0x3498DB,
+		Footer: &discordgo.MessageEmbedFooter{Text: fmt.Sprintf("Page %d of %d • %d events", page+1, pages, len(entries))},
+	}
+	if len(entries) == 0 {
+		embed.Description = "No history recorded for <@" + userID + ">."
+		return embed, nil
+	}
+
+	var b strings.Builder
+	b.WriteString("<@" + userID + ">\n\n")
+	start := page * historyPageSize
+	end := min(start+historyPageSize, len(entries))
+	for _, entry := range entries[start:end] {
+		label, ok := historyKindLabels[entry.Kind]
+		if !ok {
+			label = entry.Kind
+		}
+		line := fmt.Sprintf("<t:%d:f> **%s** %s", entry.Time.Unix(), label, entry.Summary)
+		if entry.Actor != "" {
+			line += " (by " + entry.Actor + ")"
+		}
+		b.WriteString(line + "\n")
+	}
+	embed.Description = events.TruncateText(b.String(), 4096)
+
+	components := []discordgo.MessageComponent{
+		discordgo.ActionsRow{
+			Components: []discordgo.MessageComponent{
+				discordgo.Button{
+					Label:    "Previous",
+					Style:    discordgo.SecondaryButton,
+					CustomID: fmt.Sprintf("history_page_%s_%d", userID, page-1),
+					Disabled: page == 0,
+				},
+				discordgo.Button{
+					Label:    "Next",
+					Style:    discordgo.SecondaryButton,
+					CustomID: fmt.Sprintf("history_page_%s_%d", userID, page+1),
+					Disabled: page >= pages-1,
+				},
+			},
+		},
+	}
+	return embed, components
+}
@@ -0,0 +1,134 @@
+package commands
+
+import (
+	"fmt"
+	"log"
+
+	"djs-zth-utilities/events"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func Infractions(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	if i.Type != discordgo.InteractionApplicationCommand {
+		return
+	}
+	if i.ApplicationCommandData().Name != "infractions" {
+		return
+	}
+
+	if !events.HasModeratorRole(i.Member) {
+		err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseChannelMessageWithSource,
+			Data: &discordgo.InteractionResponseData{
+				Content: "You do not have permission to view infractions.",
+				Flags:   discordgo.MessageFlagsEphemeral,
+			},
+		})
+		if err != nil {
+			log.Println("Error sending interaction response:", err)
+		}
+		return
+	}
+
+	user := i.ApplicationCommandData().Options[0].UserValue(s)
+	infractions, err := events.Infractions(user.ID)
+	if err != nil {
+		log.Printf("Error reading infractions for %s: %v", user.ID, err)
+	}
+
+	active := 0
+	description := ""
+	// Newest first, stopping before the embed description limit
+	for idx := len(infractions) - 1; idx >= 0; idx-- {
+		inf := infractions[idx]
+		line := fmt.Sprintf("**#%d** <t:%d:d> by <@%s>: %s", inf.ID, inf.CreatedAt.Unix(), inf.ModeratorID, inf.Reason)
+		if inf.CaseID != 0 {
+			line += fmt.Sprintf(" (case #%d)", inf.CaseID)
+		}
+		if inf.PardonedBy != "" {
+			line = "~~" + line + "~~ pardoned by <@" + inf.PardonedBy + ">"
+		} else if inf.Active() {
+			active++
+		} else {
+			line += " *(expired)*"
+		}
+		if len(description)+len(line) > 4000 {
+			description += fmt.Sprintf("...and %d older", idx+1)
+			break
+		}
+		description += line + "\n"
+	}
+	if description == "" {
+		description = "No infractions recorded."
+	}
+
+	embed := &discordgo.MessageEmbed{
+		Title:       "Infractions - " + user.Username,
+		Description: description,
+		Color:       0xFF9900,
+		Footer: &discordgo.MessageEmbedFooter{
+			Text: fmt.Sprintf("%d total • %d active", len(infractions), active),
+		},
+	}
+	err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Embeds: []*discordgo.MessageEmbed{embed},
+			Flags:  discordgo.MessageFlagsEphemeral,
+		},
+	})
+	if err != nil {
+		log.Println("Error sending interaction response:", err)
+	}
+}
+
+func Pardon(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	if i.Type != discordgo.InteractionApplicationCommand {
+		return
+	}
+	if i.ApplicationCommandData().Name != "pardon" {
+		return
+	}
+
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Flags: discordgo.MessageFlagsEphemeral,
+		},
+	})
+	if err != nil {
+		log.Println("Error acknowledging interaction:", err)
+		return
+	}
+
+	content := ""
+	if !events.HasModeratorRole(i.Member) {
+		content = "You do not have permission to pardon warnings."
+	} else {
+		optionMap := buildOptionMap(i.ApplicationCommandData().Options)
+		user := optionMap["user"].UserValue(s)
+		id := 0
+		if opt, ok := optionMap["warning"]; ok {
+			id = int(opt.IntValue())
+		}
+		reason := ""
+		if opt, ok := optionMap["reason"]; ok {
+			reason = opt.StringValue()
+		}
+		inf, err := events.Pardon(s, user.ID, id, i.Member.User.ID, reason)
+		if err != nil {
+			content = "Could not pardon the warning: " + err.Error()
+		} else {
+			content = fmt.Sprintf("Warning #%d for <@%s> has been pardoned.", inf.ID, user.ID)
+		}
+	}
+
+	_, err = s.FollowupMessageCreate(i.Interaction, true, &discordgo.WebhookParams{
+		Content: content,
+		Flags:   discordgo.MessageFlagsEphemeral,
+	})
+	if err != nil {
+		log.Println("Error sending follow-up message:", err)
+	}
+}
@@ -4,6 +4,8 @@ import (
 	"log"
 	"strings"
 
+	"djs-zth-utilities/events"
+
 	"github.com/bwmarrin/discordgo"
 )
 
@@ -26,7 +28,7 @@ func ListRole(s *discordgo.Session, i *discordgo.InteractionCreate) {
 				return
 			}
 
-			if !CheckApprovedRole(s, i.Member) {
+			if !events.HasApproverRole(i.Member) {
 				_, err = s.FollowupMessageCreate(i.Interaction, true, &discordgo.WebhookParams{
 					Content: "You do not have permission to list members with roles.",
 					Flags:   discordgo.MessageFlagsEphemeral,
@@ -37,35 +39,9 @@ func ListRole(s *discordgo.Session, i *discordgo.InteractionCreate) {
 				return
 			}
 
-			var allMembers []*discordgo.Member
-			lastUserID := ""
-
-			// Fetch all members with the role
-			for {
-				members, err := s.GuildMembers(i.GuildID, lastUserID, 1000)
-				if err != nil {
-					s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
-						Type: discordgo.InteractionResponseChannelMessageWithSource,
-						Data: &discordgo.InteractionResponseData{
-							Content: "Failed to fetch guild members.",
-						},
-					})
-					return
-				}
-
-				if len(members) == 0 {
-					break
-				}
-
-				allMembers = append(allMembers, members...)
-				lastUserID = members[len(members)-1].User.ID
-			}
-
 			var memberList []string
-			for _, member := range allMembers {
-				if contains(member.Roles, role.ID) {
-					memberList = append(memberList, member.User.Username)
-				}
+			for _, member := range events.Members().WithRole(role.ID) {
+				memberList = append(memberList, member.User.Username)
 			}
 
 			// Send the list of members
@@ -0,0 +1,94 @@
+package commands
+
+import (
+	"log"
+	"time"
+
+	"djs-zth-utilities/events"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func Timeout(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	moderationCommand(s, i, "timeout", "timed out", func(optionMap map[string]*discordgo.ApplicationCommandInteractionDataOption) events.ModerationAction {
+		return events.ModerationAction{
+			Action:   "timeout",
+			Duration: time.Duration(optionMap["minutes"].IntValue()) * time.Minute,
+		}
+	})
+}
+
+func Kick(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	moderationCommand(s, i, "kick", "kicked", func(optionMap map[string]*discordgo.ApplicationCommandInteractionDataOption) events.ModerationAction {
+		return events.ModerationAction{Action: "kick"}
+	})
+}
+
+func Ban(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	moderationCommand(s, i, "ban", "banned", func(optionMap map[string]*discordgo.ApplicationCommandInteractionDataOption) events.ModerationAction {
+		action := events.ModerationAction{Action: "ban"}
+		if opt, ok := optionMap["delete-days"]; ok {
+			action.DeleteDays = int(opt.IntValue())
+		}
+		return action
+	})
+}
+
+// moderationCommand handles /timeout, /kick and /ban, which share the user
+// and reason options and are limited to moderatorRoleId
+func moderationCommand(s *discordgo.Session, i *discordgo.InteractionCreate, name, done string, build func(map[string]*discordgo.ApplicationCommandInteractionDataOption) events.ModerationAction) {
+	if i.Type != discordgo.InteractionApplicationCommand {
+		return
+	}
+	if i.ApplicationCommandData().Name != name {
+		return
+	}
+
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Flags: discordgo.MessageFlagsEphemeral,
+		},
+	})
+	if err != nil {
+		log.Println("Error acknowledging interaction:", err)
+		return
+	}
+
+	optionMap := buildOptionMap(i.ApplicationCommandData().Options)
+	action := build(optionMap)
+	action.Target = optionMap["user"].UserValue(s)
+	action.ModeratorID = i.Member.User.ID
+	action.Moderator = i.Member
+	action.Reason = optionMap["reason"].StringValue()
+
+	var content string
+	switch {
+	case !events.HasModeratorRole(i.Member):
+		content = "You do not have permission to use this command."
+	case action.Target.ID == i.Member.User.ID:
+		content = "You can't use this command on yourself."
+	case name == "ban" && events.BanApprovalRequired():
+		if err := events.RequestBan(s, i.GuildID, action); err != nil {
+			log.Printf("Error requesting ban of %s: %v", action.Target.ID, err)
+			content = "Error sending the ban request. Please try again later."
+		} else {
+			content = "Your request to ban <@" + action.Target.ID + "> has been sent for approval by another moderator."
+		}
+	default:
+		if err := events.Moderate(s, i.GuildID, action); err != nil {
+			log.Printf("Error running /%s on %s: %v", name, action.Target.ID, err)
+			content = "Failed: " + err.Error()
+		} else {
+			content = "<@" + action.Target.ID + "> has been " + done + "."
+		}
+	}
+
+	_, err = s.FollowupMessageCreate(i.Interaction, true, &discordgo.WebhookParams{
+		Content: content,
+		Flags:   discordgo.MessageFlagsEphemeral,
+	})
+	if err != nil {
+		log.Println("Error sending follow-up message:", err)
+	}
+}
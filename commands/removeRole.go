@@ -19,7 +19,7 @@ func RemoveRole(s *discordgo.Session, i *discordgo.InteractionCreate) {
 			user := i.Member.User
 
 			// Verify that the user has permission to remove roles
-			if !CheckApprovedRole(s, i.Member) {
+			if !events.HasApproverRole(i.Member) {
 				_, err := s.FollowupMessageCreate(i.Interaction, true, &discordgo.WebhookParams{
 					Content: "You do not have permission to remove roles.",
 					Flags:   discordgo.MessageFlagsEphemeral,
@@ -0,0 +1,101 @@
+package commands
+
+import (
+	"log"
+
+	"djs-zth-utilities/events"
+	"djs-zth-utilities/wow"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/spf13/viper"
+)
+
+func SetNick(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	if i.Type != discordgo.InteractionApplicationCommand {
+		return
+	}
+	if i.ApplicationCommandData().Name != "setnick" {
+		return
+	}
+	user := i.Member.User
+	mainCharacter := wow.NormalizeCharacter(i.ApplicationCommandData().Options[0].StringValue(), "").Name
+
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Flags: discordgo.MessageFlagsEphemeral,
+		},
+	})
+	if err != nil {
+		log.Println("Error acknowledging interaction:", err)
+		return
+	}
+
+	if mainCharacter == "" || !events.NicknameMatchesPolicy(mainCharacter, mainCharacter) {
+		_, err = s.FollowupMessageCreate(i.Interaction, true, &discordgo.WebhookParams{
+			Content: "That main character name can't be used as a nickname. Please check the spelling and try again.",
+			Flags:   discordgo.MessageFlagsEphemeral,
+		})
+		if err != nil {
+			log.Println("Error sending follow-up message:", err)
+		}
+		return
+	}
+
+	approvalRole := viper.GetString("roleApproverId")
+	embed := &discordgo.MessageEmbed{
+		Title:       "Nickname Request",
+		Description: "<@" + user.ID + "> (" + user.Username + ") has requested to set their nickname to their main character.",
+		Color:       0x0099ff,
+		Fields: []*discordgo.MessageEmbedField{
+			{
+				Name:   "Main Character",
+				Value:  mainCharacter,
+				Inline: true,
+			},
+			{
+				Name:   "Current Nickname",
+				Value:  currentNickname(i.Member),
+				Inline: true,
+			},
+		},
+	}
+	_, err = s.ChannelMessageSendComplex(viper.GetString("accessControlChannelId"), &discordgo.MessageSend{
+		Content: "||<@&" + approvalRole + ">||",
+		Embeds:  []*discordgo.MessageEmbed{embed},
+		Components: []discordgo.MessageComponent{
+			discordgo.ActionsRow{
+				Components: []discordgo.MessageComponent{
+					discordgo.Button{
+						Label:    "Approve",
+						Style:    discordgo.PrimaryButton,
+						CustomID: "approve_setnick_" + user.ID,
+					},
+					discordgo.Button{
+						Label:    "Deny",
+						Style:    discordgo.DangerButton,
+						CustomID: "deny_setnick_" + user.ID,
+					},
+				},
+			},
+		},
+	})
+	if err != nil {
+		log.Println("Error sending nickname request to access channel:", err)
+	}
+
+	_, err = s.FollowupMessageCreate(i.Interaction, true, &discordgo.WebhookParams{
+		Content: "Your nickname request for `" + mainCharacter + "` has been sent for approval.",
+		Flags:   discordgo.MessageFlagsEphemeral,
+	})
+	if err != nil {
+		log.Println("Error sending follow-up message:", err)
+	}
+}
+
+func currentNickname(m *discordgo.Member) string {
+	if m.Nick != "" {
+		return m.Nick
+	}
+	return "None"
+}
@@ -0,0 +1,63 @@
+package commands
+
+import (
+	"log"
+
+	"djs-zth-utilities/events"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/spf13/viper"
+)
+
+func Transcript(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	if i.Type != discordgo.InteractionApplicationCommand {
+		return
+	}
+	if i.ApplicationCommandData().Name != "transcript" {
+		return
+	}
+
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Flags: discordgo.MessageFlagsEphemeral,
+		},
+	})
+	if err != nil {
+		log.Println("Error acknowledging interaction:", err)
+		return
+	}
+
+	if !events.HasApproverRole(i.Member) {
+		_, err = s.FollowupMessageCreate(i.Interaction, true, &discordgo.WebhookParams{
+			Content: "You do not have permission to generate transcripts.",
+			Flags:   discordgo.MessageFlagsEphemeral,
+		})
+		if err != nil {
+			log.Println("Error sending follow-up message:", err)
+		}
+		return
+	}
+
+	thread := i.ApplicationCommandData().Options[0].ChannelValue(s)
+
+	// Only ticket threads, other threads may be private staff discussions
+	var msg *discordgo.Message
+	content := "Transcript for <#" + thread.ID + "> has been generated."
+	if thread.ParentID != viper.GetString("ticketChannelId") {
+		content = "Transcripts can only be generated for ticket threads."
+	} else if msg, err = events.PostTicketTranscript(s, thread); err != nil {
+		log.Printf("Error generating transcript for thread %s: %v", thread.ID, err)
+		content = "Error generating transcript. Please try again later."
+	} else if msg != nil {
+		content += " https://discord.com/channels/" + i.GuildID + "/" + msg.ChannelID + "/" + msg.ID
+	}
+
+	_, err = s.FollowupMessageCreate(i.Interaction, true, &discordgo.WebhookParams{
+		Content: content,
+		Flags:   discordgo.MessageFlagsEphemeral,
+	})
+	if err != nil {
+		log.Println("Error sending follow-up message:", err)
+	}
+}
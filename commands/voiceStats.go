@@ -0,0 +1,112 @@
+package commands
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"djs-zth-utilities/events"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func VoiceStats(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	if i.Type != discordgo.InteractionApplicationCommand {
+		return
+	}
+	if i.ApplicationCommandData().Name != "voicestats" {
+		return
+	}
+
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Flags: discordgo.MessageFlagsEphemeral,
+		},
+	})
+	if err != nil {
+		log.Println("Error acknowledging interaction:", err)
+		return
+	}
+
+	if !events.HasApproverRole(i.Member) {
+		_, err = s.FollowupMessageCreate(i.Interaction, true, &discordgo.WebhookParams{
+			Content: "You do not have permission to view voice statistics.",
+			Flags:   discordgo.MessageFlagsEphemeral,
+		})
+		if err != nil {
+			log.Println("Error sending follow-up message:", err)
+		}
+		return
+	}
+
+	var channelID, scope string
+	var userIDs []string
+	days := 30
+	for _, option := range i.ApplicationCommandData().Options {
+		switch option.Name {
+		case "channel":
+			channelID = option.ChannelValue(s).ID
+			scope += " in <#" + channelID + ">"
+		case "role":
+			role := option.RoleValue(s, i.GuildID)
+			userIDs = []string{}
+			for _, member := range events.Members().WithRole(role.ID) {
+				userIDs = append(userIDs, member.User.ID)
+			}
+			scope += " for <@&" + role.ID + ">"
+		case "days":
+			days = int(option.IntValue())
+		}
+	}
+
+	since := time.Now().AddDate(0, 0, -days)
+	stats, err := events.VoiceStats(channelID, userIDs, since)
+	if err != nil {
+		log.Printf("Error reading voice stats: %v", err)
+		_, err = s.FollowupMessageCreate(i.Interaction, true, &discordgo.WebhookParams{
+			Content: "Error reading voice statistics. Please try again later.",
+			Flags:   discordgo.MessageFlagsEphemeral,
+		})
+		if err != nil {
+			log.Println("Error sending follow-up message:", err)
+		}
+		return
+	}
+
+	var total time.Duration
+	for _, stat := range stats {
+		total += stat.Total
+	}
+
+	description := "No voice activity recorded."
+	if len(stats) > 0 {
+		var b strings.Builder
+		lines := events.FormatVoiceStats(stats)
+		for idx, line := range lines {
+			if b.Len()+len(line)+40 > 4000 {
+				fmt.Fprintf(&b, "...and %d more", len(lines)-idx)
+				break
+			}
+			b.WriteString(line + "\n")
+		}
+		description = b.String()
+	}
+
+	embed := &discordgo.MessageEmbed{
+		Title:       fmt.Sprintf("Voice Activity (last %d days)", days),
+		Description: strings.TrimSpace("Voice time" + scope + "\n\n" + description),
+		Color:       0x1ABC9C,
+		Footer: &discordgo.MessageEmbedFooter{
+			Text: fmt.Sprintf("%d members • %.1f hours in total", len(stats), total.Hours()),
+		},
+	}
+	_, err = s.FollowupMessageCreate(i.Interaction, true, &discordgo.WebhookParams{
+		Embeds: []*discordgo.MessageEmbed{embed},
+		Flags:  discordgo.MessageFlagsEphemeral,
+	})
+	if err != nil {
+		log.Println("Error sending follow-up message:", err)
+	}
+}
@@ -0,0 +1,53 @@
+package commands
+
+import (
+	"fmt"
+	"log"
+
+	"djs-zth-utilities/events"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func Warn(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	if i.Type != discordgo.InteractionApplicationCommand {
+		return
+	}
+	if i.ApplicationCommandData().Name != "warn" {
+		return
+	}
+
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Flags: discordgo.MessageFlagsEphemeral,
+		},
+	})
+	if err != nil {
+		log.Println("Error acknowledging interaction:", err)
+		return
+	}
+
+	content := ""
+	if !events.HasModeratorRole(i.Member) {
+		content = "You do not have permission to warn members."
+	} else {
+		optionMap := buildOptionMap(i.ApplicationCommandData().Options)
+		user := optionMap["user"].UserValue(s)
+		inf, err := events.Warn(s, i.GuildID, user, i.Member.User.ID, optionMap["reason"].StringValue(), 0)
+		if err != nil {
+			log.Printf("Error warning %s: %v", user.ID, err)
+			content = "Error recording the warning. Please try again later."
+		} else {
+			content = fmt.Sprintf("Warning #%d recorded for <@%s>.", inf.ID, user.ID)
+		}
+	}
+
+	_, err = s.FollowupMessageCreate(i.Interaction, true, &discordgo.WebhookParams{
+		Content: content,
+		Flags:   discordgo.MessageFlagsEphemeral,
+	})
+	if err != nil {
+		log.Println("Error sending follow-up message:", err)
+	}
+}
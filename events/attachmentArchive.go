@@ -0,0 +1,173 @@
+package events
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/spf13/viper"
+)
+
+var (
+	attachmentClient      = &http.Client{Timeout: 30 * time.Second}
+	attachmentCleanupOnce sync.Once
+)
+
+// attachmentDir returns the directory attachments for a message are
+// archived to
+func attachmentDir(channelId, messageId string) string {
+	dir := viper.GetString("attachmentArchive.dir")
+	if dir == "" {
+		dir = "attachments"
+	}
+	return filepath.Join(dir, channelId, messageId)
+}
+
+// archiveAttachments downloads a message's attachments that are under
+// attachmentArchive.maxBytes so they can be re-uploaded if the message is
+// deleted
+func archiveAttachments(m *discordgo.Message) {
+	if !viper.GetBool("attachmentArchive.enabled") || len(m.Attachments) == 0 {
+		return
+	}
+	maxBytes := viper.GetInt("attachmentArchive.maxBytes")
+	dir := attachmentDir(m.ChannelID, m.ID)
+	for _, attachment := range m.Attachments {
+		if maxBytes > 0 && attachment.Size > maxBytes {
+			continue
+		}
+		if err := downloadAttachment(attachment, dir, int64(maxBytes)); err != nil {
+			log.Printf("Error archiving attachment %s: %v", attachment.ID, err)
+		}
+	}
+}
+
+// downloadAttachment saves an attachment, giving up if it turns out to be
+// larger than maxBytes (0 for no limit)
+func downloadAttachment(attachment *discordgo.MessageAttachment, dir string, maxBytes int64) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	resp, err := attachmentClient.Get(attachment.URL)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	// Prefix with the attachment ID so two files with the same name don't
+	// overwrite each other
+	path := filepath.Join(dir, attachment.ID+"_"+filepath.Base(attachment.Filename))
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	var body io.Reader = resp.Body
+	if maxBytes > 0 {
+		// Read one byte past the limit to tell a full file from a cut off one
+		body = io.LimitReader(resp.Body, maxBytes+1)
+	}
+	written, err := io.Copy(file, body)
+	if err == nil && maxBytes > 0 && written > maxBytes {
+		err = fmt.Errorf("attachment is larger than %d bytes", maxBytes)
+	}
+	if err != nil {
+		file.Close()
+		os.Remove(path)
+	}
+	return err
+}
+
+// archivedAttachmentFiles opens the archived copies of a message's
+// attachments for re-uploading. Call the returned func to close them.
+func archivedAttachmentFiles(m *discordgo.Message) ([]*discordgo.File, func()) {
+	var files []*discordgo.File
+	var opened []*os.File
+	dir := attachmentDir(m.ChannelID, m.ID)
+	for _, attachment := range m.Attachments {
+		file, err := os.Open(filepath.Join(dir, attachment.ID+"_"+filepath.Base(attachment.Filename)))
+		if err != nil {
+			continue
+		}
+		opened = append(opened, file)
+		files = append(files, &discordgo.File{
+			Name:        attachment.Filename,
+			ContentType: attachment.ContentType,
+			Reader:      file,
+		})
+		// Discord allows at most 10 files per message
+		if len(files) == 10 {
+			break
+		}
+	}
+	return files, func() {
+		for _, file := range opened {
+			file.Close()
+		}
+	}
+}
+
+// removeArchivedAttachments deletes the archived copies of a message's
+// attachments
+func removeArchivedAttachments(m *discordgo.Message) {
+	if len(m.Attachments) == 0 {
+		return
+	}
+	if err := os.RemoveAll(attachmentDir(m.ChannelID, m.ID)); err != nil {
+		log.Printf("Error removing archived attachments for %s: %v", m.ID, err)
+	}
+}
+
+// StartAttachmentCleanup removes archived attachments older than
+// attachmentArchive.retentionHours once an hour
+func StartAttachmentCleanup() {
+	attachmentCleanupOnce.Do(func() {
+		hours := viper.GetInt("attachmentArchive.retentionHours")
+		if !viper.GetBool("attachmentArchive.enabled") || hours <= 0 {
+			return
+		}
+		go func() {
+			ticker := time.NewTicker(time.Hour)
+			defer ticker.Stop()
+			for ; true; <-ticker.C {
+				cleanupAttachments(time.Duration(hours) * time.Hour)
+			}
+		}()
+	})
+}
+
+func cleanupAttachments(retention time.Duration) {
+	root := viper.GetString("attachmentArchive.dir")
+	if root == "" {
+		root = "attachments"
+	}
+	channels, err := os.ReadDir(root)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("Error reading attachment archive: %v", err)
+		}
+		return
+	}
+	for _, channel := range channels {
+		messages, err := os.ReadDir(filepath.Join(root, channel.Name()))
+		if err != nil {
+			continue
+		}
+		for _, message := range messages {
+			info, err := message.Info()
+			if err != nil || time.Since(info.ModTime()) < retention {
+				continue
+			}
+			os.RemoveAll(filepath.Join(root, channel.Name(), message.Name()))
+		}
+	}
+}
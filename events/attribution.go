@@ -0,0 +1,316 @@
+package events
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	// How long tracked bot commands and audit log entries are kept for
+	// matching against member updates
+	attributionTTL = 2 * time.Minute
+	// How long to wait for the audit log entry of a member update, which
+	// Discord may deliver after the update itself
+	attributionWait = 5 * time.Second
+	// How old an audit log entry may be to be credited with a change that
+	// just happened
+	recentEntryAge = 30 * time.Second
+)
+
+// Attribution is who made a role change. InvokerID is set when the bot
+// made the change on someone's behalf, e.g. through /addrole or an
+// approval button.
+type Attribution struct {
+	ExecutorID string
+	InvokerID  string
+}
+
+// String formats the attribution for an embed field
+func (a Attribution) String() string {
+	switch {
+	case a.InvokerID != "":
+		return "<@" + a.InvokerID + "> (via bot)"
+	case a.ExecutorID != "":
+		return "<@" + a.ExecutorID + ">"
+	default:
+		return "Unknown"
+	}
+}
+
+// UserID returns the member the change should be credited to
+func (a Attribution) UserID() string {
+	if a.InvokerID != "" {
+		return a.InvokerID
+	}
+	return a.ExecutorID
+}
+
+type trackedCommand struct {
+	invokerID string
+	expires   time.Time
+}
+
+type receivedEntry struct {
+	entry    *discordgo.AuditLogEntry
+	received time.Time
+}
+
+var attributions = struct {
+	mu       sync.Mutex
+	commands map[string]trackedCommand
+	entries  []receivedEntry
+	// notify is closed and replaced whenever an audit log entry arrives
+	notify chan struct{}
+}{
+	commands: make(map[string]trackedCommand),
+	notify:   make(chan struct{}),
+}
+
+// TrackRoleCommand records who asked the bot to change a member's role so
+// the change is credited to them rather than the bot
+func TrackRoleCommand(targetUserID, invokerUserID, roleID string) {
+	attributions.mu.Lock()
+	defer attributions.mu.Unlock()
+	attributions.commands[targetUserID+":"+roleID] = trackedCommand{
+		invokerID: invokerUserID,
+		expires:   time.Now().Add(attributionTTL),
+	}
+}
+
+// timeoutCommandKey stands in for a role ID when tracking timeouts
+const timeoutCommandKey = "timeout"
+
+// TrackTimeoutCommand records who asked the bot to time a member out so
+// the timeout is credited to them rather than the bot
+func TrackTimeoutCommand(targetUserID, invokerUserID string) {
+	TrackRoleCommand(targetUserID, invokerUserID, timeoutCommandKey)
+}
+
+// timeoutInvoker returns who asked the bot to time a member out, if anyone
+func timeoutInvoker(targetUserID string) string {
+	attributions.mu.Lock()
+	defer attributions.mu.Unlock()
+	return trackedInvokerLocked(targetUserID, []string{timeoutCommandKey}, nil)
+}
+
+// OnAuditLogEntryCreate keeps recent audit log entries so member, channel
+// and role changes can be credited to whoever made them
+func OnAuditLogEntryCreate(s *discordgo.Session, e *discordgo.GuildAuditLogEntryCreate) {
+	if e.AuditLogEntry == nil || e.ActionType == nil {
+		return
+	}
+	attributions.mu.Lock()
+	defer attributions.mu.Unlock()
+	now := time.Now()
+	kept := attributions.entries[:0]
+	for _, received := range attributions.entries {
+		if now.Sub(received.received) < attributionTTL {
+			kept = append(kept, received)
+		}
+	}
+	attributions.entries = append(kept, receivedEntry{entry: e.AuditLogEntry, received: now})
+	close(attributions.notify)
+	attributions.notify = make(chan struct{})
+}
+
+// RoleChangeAttribution finds who added or removed roles from a member by
+// matching the change against audit log entries from the gateway, waiting
+// briefly for the entry to arrive. The audit log is fetched directly if
+// none arrives.
+func RoleChangeAttribution(s *discordgo.Session, guildID, targetUserID string, added, removed []string) Attribution {
+	deadline := time.After(attributionWait)
+	for {
+		attributions.mu.Lock()
+		attribution, found := matchRoleChange(s, targetUserID, added, removed)
+		notify := attributions.notify
+		attributions.mu.Unlock()
+		if found {
+			return attribution
+		}
+
+		select {
+		case <-notify:
+		case <-deadline:
+			return fetchRoleChangeAttribution(s, guildID, targetUserID, added, removed)
+		}
+	}
+}
+
+// matchRoleChange looks for a received entry covering the change. The
+// caller must hold attributions.mu.
+func matchRoleChange(s *discordgo.Session, targetUserID string, added, removed []string) (Attribution, bool) {
+	for idx := len(attributions.entries) - 1; idx >= 0; idx-- {
+		entry := attributions.entries[idx].entry
+		if *entry.ActionType == discordgo.AuditLogActionMemberRoleUpdate && entry.TargetID == targetUserID && entryChangesRoles(entry, added, removed) {
+			return attributeEntry(s, entry, targetUserID, added, removed), true
+		}
+	}
+	return Attribution{}, false
+}
+
+func fetchRoleChangeAttribution(s *discordgo.Session, guildID, targetUserID string, added, removed []string) Attribution {
+	auditLogs, err := s.GuildAuditLog(guildID, "", "", int(discordgo.AuditLogActionMemberRoleUpdate), 50)
+	if err != nil {
+		log.Printf("Error fetching audit log: %v", err)
+		return Attribution{InvokerID: trackedInvoker(targetUserID, added, removed)}
+	}
+	for _, entry := range auditLogs.AuditLogEntries {
+		entryTime, err := discordgo.SnowflakeTimestamp(entry.ID)
+		if err != nil || time.Since(entryTime) > attributionTTL {
+			break
+		}
+		if entry.TargetID == targetUserID && entryChangesRoles(entry, added, removed) {
+			attributions.mu.Lock()
+			attribution := attributeEntry(s, entry, targetUserID, added, removed)
+			attributions.mu.Unlock()
+			return attribution
+		}
+	}
+	log.Printf("No audit log entry found for role change on %s", targetUserID)
+	return Attribution{}
+}
+
+// attributeEntry credits the bot's own changes to whoever invoked them.
+// The caller must hold attributions.mu.
+func attributeEntry(s *discordgo.Session, entry *discordgo.AuditLogEntry, targetUserID string, added, removed []string) Attribution {
+	attribution := Attribution{ExecutorID: entry.UserID}
+	if s.State != nil && s.State.User != nil && entry.UserID == s.State.User.ID {
+		attribution.InvokerID = trackedInvokerLocked(targetUserID, added, removed)
+	}
+	return attribution
+}
+
+func trackedInvoker(targetUserID string, added, removed []string) string {
+	attributions.mu.Lock()
+	defer attributions.mu.Unlock()
+	return trackedInvokerLocked(targetUserID, added, removed)
+}
+
+func trackedInvokerLocked(targetUserID string, added, removed []string) string {
+	now := time.Now()
+	for key, command := range attributions.commands {
+		if now.After(command.expires) {
+			delete(attributions.commands, key)
+		}
+	}
+	for _, roleID := range append(append([]string{}, added...), removed...) {
+		if command, exists := attributions.commands[targetUserID+":"+roleID]; exists {
+			return command.invokerID
+		}
+	}
+	return ""
+}
+
+// entryChangesRoles reports whether an audit log entry added or removed
+// any of the roles
+func entryChangesRoles(entry *discordgo.AuditLogEntry, added, removed []string) bool {
+	for _, change := range entry.Changes {
+		if change.Key == nil {
+			continue
+		}
+		var roles []string
+		switch *change.Key {
+		case discordgo.AuditLogChangeKeyRoleAdd:
+			roles = added
+		case discordgo.AuditLogChangeKeyRoleRemove:
+			roles = removed
+		default:
+			continue
+		}
+		values, _ := change.NewValue.([]interface{})
+		for _, value := range values {
+			role, _ := value.(map[string]interface{})
+			if id, _ := role["id"].(string); contains(roles, id) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// recentAuditEntry finds the audit log entry for an action on a member,
+// channel or role from the gateway, waiting briefly for it to arrive. With
+// a key, only entries changing that key match, so e.g. a timeout isn't
+// credited for a nickname change. The audit log is fetched directly if
+// none arrives.
+func recentAuditEntry(s *discordgo.Session, guildID, targetID string, key discordgo.AuditLogChangeKey, actions []discordgo.AuditLogAction) *discordgo.AuditLogEntry {
+	deadline := time.After(attributionWait)
+	for {
+		attributions.mu.Lock()
+		entry := matchAuditEntry(targetID, key, actions)
+		notify := attributions.notify
+		attributions.mu.Unlock()
+		if entry != nil {
+			return entry
+		}
+
+		select {
+		case <-notify:
+		case <-deadline:
+			return fetchAuditEntry(s, guildID, targetID, key, actions)
+		}
+	}
+}
+
+// matchAuditEntry looks for a recent received entry of one of the actions
+// on the target. The caller must hold attributions.mu.
+func matchAuditEntry(targetID string, key discordgo.AuditLogChangeKey, actions []discordgo.AuditLogAction) *discordgo.AuditLogEntry {
+	for idx := len(attributions.entries) - 1; idx >= 0; idx-- {
+		entry := attributions.entries[idx].entry
+		if entry.TargetID == targetID && isRecentAction(entry, actions) && changesKey(entry, key) {
+			return entry
+		}
+	}
+	return nil
+}
+
+func fetchAuditEntry(s *discordgo.Session, guildID, targetID string, key discordgo.AuditLogChangeKey, actions []discordgo.AuditLogAction) *discordgo.AuditLogEntry {
+	for _, action := range actions {
+		auditLogs, err := s.GuildAuditLog(guildID, "", "", int(action), 50)
+		if err != nil {
+			log.Printf("Error fetching audit log: %v", err)
+			continue
+		}
+		for _, entry := range auditLogs.AuditLogEntries {
+			if entry.TargetID == targetID && isRecentAction(entry, actions) && changesKey(entry, key) {
+				return entry
+			}
+		}
+	}
+	return nil
+}
+
+// isRecentAction reports whether an entry is one of the actions and new
+// enough to belong to a change that just happened
+func isRecentAction(entry *discordgo.AuditLogEntry, actions []discordgo.AuditLogAction) bool {
+	if entry.ActionType == nil {
+		return false
+	}
+	entryTime, err := discordgo.SnowflakeTimestamp(entry.ID)
+	if err != nil || time.Since(entryTime) > recentEntryAge {
+		return false
+	}
+	for _, action := range actions {
+		if *entry.ActionType == action {
+			return true
+		}
+	}
+	return false
+}
+
+// changesKey reports whether an entry changed key, which any entry does
+// when key is empty
+func changesKey(entry *discordgo.AuditLogEntry, key discordgo.AuditLogChangeKey) bool {
+	if key == "" {
+		return true
+	}
+	for _, change := range entry.Changes {
+		if change.Key != nil && *change.Key == key {
+			return true
+		}
+	}
+	return false
+}
@@ -1,116 +1,28 @@
 package events
 
 import (
+	"fmt"
 	"log"
-	"strconv"
 	"strings"
-	"time"
 
 	"github.com/bwmarrin/discordgo"
-	lru "github.com/hashicorp/golang-lru"
 	"github.com/spf13/viper"
 )
 
-var (
-	auditLogChannelId string
-	messageCache      *lru.Cache
-	memberCache       *lru.Cache
-	roleCommandCache  *lru.Cache
-	messageToLog      string
-	embed             *discordgo.MessageEmbed
-)
-
-// Initialize the role command cache if needed
-func init() {
-	if roleCommandCache == nil {
-		roleCommandCache, _ = lru.New(1000)
-	}
-}
+var messageCache = &messageStore{}
 
 func OnMemberJoin(s *discordgo.Session, m *discordgo.GuildMemberAdd) {
-	auditLogChannelId = viper.GetString("auditLogChannelId")
 	// Cache the member
-	memberCache.Add(m.User.ID, &discordgo.Member{
-		User:  m.User,
-		Roles: m.Roles,
-	})
-	log.Printf("Cached member: %s", m.User.ID)
+	memberCache.Add(m.Member)
+	recordHistory(m.User.ID, HistoryJoin, "", "Joined the server")
 	// Send a message to the audit log channel
-	message := "User <@" + m.User.ID + "> has joined the server"
-	_, err := s.ChannelMessageSend(auditLogChannelId, message)
+	_, err := sendAudit(s, AuditJoins, "", &discordgo.MessageSend{
+		Embeds: []*discordgo.MessageEmbed{memberJoinEmbed(s, m)},
+	})
 	if err != nil {
 		s.ChannelMessageSend(m.GuildID, "Error sending message to audit log channel")
 	}
-}
-
-// TrackRoleCommand tracks who invoked a role command
-func TrackRoleCommand(targetUserID, invokerUserID, roleID string) {
-	if roleCommandCache == nil {
-		roleCommandCache, _ = lru.New(1000)
-	}
-	key := targetUserID + ":" + roleID
-	roleCommandCache.Add(key, invokerUserID)
-
-	log.Printf("TrackRoleCommand: Tracking key=%s, invoker=%s", key, invokerUserID)
-
-	// Remove the entry after 10 seconds to prevent stale data
-	go func() {
-		time.Sleep(10 * time.Second)
-		roleCommandCache.Remove(key)
-		log.Printf("TrackRoleCommand: Removed expired key=%s", key)
-	}()
-}
-
-// Helper function to get the user who performed the role change
-func getResponsibleUser(s *discordgo.Session, guildID string, targetUserID string, actionType discordgo.AuditLogAction) string {
-	// First check if we have a tracked role command invoker
-	if roleCommandCache != nil {
-		log.Printf("getResponsibleUser: Checking cache for targetUserID=%s", targetUserID)
-		// Check for any role that might have been added/removed for this user
-		for _, key := range roleCommandCache.Keys() {
-			keyStr := key.(string)
-			log.Printf("getResponsibleUser: Checking cached key=%s", keyStr)
-			if strings.HasPrefix(keyStr, targetUserID+":") {
-				if invokerID, exists := roleCommandCache.Get(key); exists {
-					log.Printf("getResponsibleUser: Found cached invoker=%s for key=%s", invokerID.(string), keyStr)
-					return "<@" + invokerID.(string) + ">"
-				}
-			}
-		}
-		log.Printf("getResponsibleUser: No cached invoker found for targetUserID=%s", targetUserID)
-	}
-
-	// Fall back to audit log check
-	auditLogs, err := s.GuildAuditLog(guildID, "", "", int(actionType), 50)
-	if err != nil {
-		log.Printf("Error fetching audit log: %v", err)
-		return "Unknown"
-	}
-
-	// Look for the most recent audit log entry for this user
-	for _, entry := range auditLogs.AuditLogEntries {
-		if entry.TargetID == targetUserID {
-			// Convert string ID to int64
-			entryIDInt, err := strconv.ParseInt(entry.ID, 10, 64)
-			if err != nil {
-				log.Printf("Error parsing audit log entry ID: %v", err)
-				continue
-			}
-
-			// Check if this entry is recent (within last 30 seconds)
-			entryTime := time.Unix((entryIDInt>>22)/1000+1420070400, 0)
-			if time.Since(entryTime) < 30*time.Second {
-				userID := entry.UserID
-				user, err := s.User(userID)
-				if err == nil && user.Bot {
-					return "Bot (via slash command)"
-				}
-				return "<@" + userID + ">"
-			}
-			break
-		}
-	}
-	return "Unknown"
+	postRejoinNotice(s, m)
 }
 
 func OnMemberUpdate(s *discordgo.Session, m *discordgo.GuildMemberUpdate) {
@@ -120,47 +32,44 @@ func OnMemberUpdate(s *discordgo.Session, m *discordgo.GuildMemberUpdate) {
 	rolesChanged := false
 	var addedRoles []string
 	var removedRoles []string
-	cachedMember, exists := memberCache.Get(m.User.ID)
+	member, exists := memberCache.Get(m.User.ID)
 	if exists {
-		member, ok := cachedMember.(*discordgo.Member)
-		if ok {
-			// Compare role slices
-			if len(m.Roles) != len(member.Roles) {
-				rolesChanged = true
-			} else {
-				// Check if all roles match
-				roleMap := make(map[string]bool)
-				for _, role := range member.Roles {
-					roleMap[role] = true
-				}
-				for _, role := range m.Roles {
-					if !roleMap[role] {
-						rolesChanged = true
-						break
-					}
-				}
-			}
-
-			// Find added roles
-			oldRoleMap := make(map[string]bool)
+		// Compare role slices
+		if len(m.Roles) != len(member.Roles) {
+			rolesChanged = true
+		} else {
+			// Check if all roles match
+			roleMap := make(map[string]bool)
 			for _, role := range member.Roles {
-				oldRoleMap[role] = true
+				roleMap[role] = true
 			}
 			for _, role := range m.Roles {
-				if !oldRoleMap[role] {
-					addedRoles = append(addedRoles, role)
+				if !roleMap[role] {
+					rolesChanged = true
+					break
 				}
 			}
+		}
 
-			// Find removed roles
-			newRoleMap := make(map[string]bool)
-			for _, role := range m.Roles {
-				newRoleMap[role] = true
+		// Find added roles
+		oldRoleMap := make(map[string]bool)
+		for _, role := range member.Roles {
+			oldRoleMap[role] = true
+		}
+		for _, role := range m.Roles {
+			if !oldRoleMap[role] {
+				addedRoles = append(addedRoles, role)
 			}
-			for _, role := range member.Roles {
-				if !newRoleMap[role] {
-					removedRoles = append(removedRoles, role)
-				}
+		}
+
+		// Find removed roles
+		newRoleMap := make(map[string]bool)
+		for _, role := range m.Roles {
+			newRoleMap[role] = true
+		}
+		for _, role := range member.Roles {
+			if !newRoleMap[role] {
+				removedRoles = append(removedRoles, role)
 			}
 		}
 	} else {
@@ -170,9 +79,12 @@ func OnMemberUpdate(s *discordgo.Session, m *discordgo.GuildMemberUpdate) {
 		addedRoles = m.Roles
 	}
 
+	// Cache the update before waiting on attribution below, so a member
+	// update arriving in the meantime is compared against these roles
+	memberCache.Add(m.Member)
+
 	// Log role additions to audit channel (excluding open roles)
 	if len(addedRoles) > 0 {
-		auditLogChannelId = viper.GetString("auditLogChannelId")
 		openRoles := viper.GetStringMapString("openRoles")
 
 		// Filter out open roles
@@ -191,7 +103,8 @@ func OnMemberUpdate(s *discordgo.Session, m *discordgo.GuildMemberUpdate) {
 				rolesText += "<@&" + role + "> "
 			}
 
-			responsibleUser := getResponsibleUser(s, m.GuildID, m.User.ID, discordgo.AuditLogActionMemberRoleUpdate)
+			responsibleUser := RoleChangeAttribution(s, m.GuildID, m.User.ID, restrictedAddedRoles, nil).String()
+			recordHistory(m.User.ID, HistoryRoleAdded, responsibleUser, "Added "+rolesText)
 
 			targetUser := m.User
 			targetUsername := m.User.Username
@@ -218,7 +131,7 @@ func OnMemberUpdate(s *discordgo.Session, m *discordgo.GuildMemberUpdate) {
 				},
 			}
 
-			_, err := s.ChannelMessageSendComplex(auditLogChannelId, &discordgo.MessageSend{
+			_, err := sendAudit(s, AuditRoleChanges, "", &discordgo.MessageSend{
 				Embeds: []*discordgo.MessageEmbed{embed},
 			})
 			if err != nil {
@@ -229,7 +142,6 @@ func OnMemberUpdate(s *discordgo.Session, m *discordgo.GuildMemberUpdate) {
 
 	// Log role removals to audit channel (excluding open roles)
 	if len(removedRoles) > 0 {
-		auditLogChannelId = viper.GetString("auditLogChannelId")
 		openRoles := viper.GetStringMapString("openRoles")
 
 		// Filter out open roles
@@ -248,7 +160,8 @@ func OnMemberUpdate(s *discordgo.Session, m *discordgo.GuildMemberUpdate) {
 				rolesText += "<@&" + role + "> "
 			}
 
-			responsibleUser := getResponsibleUser(s, m.GuildID, m.User.ID, discordgo.AuditLogActionMemberRoleUpdate)
+			responsibleUser := RoleChangeAttribution(s, m.GuildID, m.User.ID, nil, restrictedRemovedRoles).String()
+			recordHistory(m.User.ID, HistoryRoleRemoved, responsibleUser, "Removed "+rolesText)
 
 			targetUser := m.User
 			targetUsername := m.User.Username
@@ -275,7 +188,7 @@ func OnMemberUpdate(s *discordgo.Session, m *discordgo.GuildMemberUpdate) {
 				},
 			}
 
-			_, err := s.ChannelMessageSendComplex(auditLogChannelId, &discordgo.MessageSend{
+			_, err := sendAudit(s, AuditRoleChanges, "", &discordgo.MessageSend{
 				Embeds: []*discordgo.MessageEmbed{embed},
 			})
 			if err != nil {
@@ -284,27 +197,22 @@ func OnMemberUpdate(s *discordgo.Session, m *discordgo.GuildMemberUpdate) {
 		}
 	}
 
+	if exists {
+		auditMemberProfileChanges(s, member, m.Member)
+	}
+
 	// Only call WelcomeNewCommunityMember if roles changed
 	if rolesChanged {
-		WelcomeNewCommunityMember(s, m)
+		var before *discordgo.Member
+		if exists {
+			before = member
+		}
+		WelcomeNewCommunityMember(s, m, before)
 	}
-
-	// Delay the cache update to allow other handlers (e.g.
-	// WelcomeNewCommunityMember) to process first
-	delay := viper.GetInt("memberCacheUpdateDelay")
-	go func() {
-		time.Sleep(time.Duration(delay) * time.Millisecond)
-		memberCache.Add(m.User.ID, &discordgo.Member{
-			User:  m.User,
-			Roles: m.Roles,
-		})
-		log.Printf("Updated cache for member: %s", m.User.ID)
-	}()
 }
 
 func OnMemberLeave(s *discordgo.Session, m *discordgo.GuildMemberRemove) {
 	rolesToPing := []string{}
-	auditLogChannelId = viper.GetString("auditLogChannelId")
 	accessControlChannelId := viper.GetString("accessControlChannelId")
 
 	// Get username for display
@@ -316,27 +224,20 @@ func OnMemberLeave(s *discordgo.Session, m *discordgo.GuildMemberRemove) {
 
 	// Send a message to the audit log channel
 	message := "User <@" + m.User.ID + "> (" + username + ") has left the server"
+	recordHistory(m.User.ID, HistoryLeave, "", "Left the server as "+username)
 
-	// Combine both role lists into restrictedRoles
-	rolesRequiringApproval := viper.GetStringSlice("rolesRequiringApproval")
-	approvedRoles := viper.GetStringSlice("approvedRoles")
-	restrictedRoles := append(rolesRequiringApproval, approvedRoles...)
+	restrictedRoles := restrictedRoleIds()
 
 	// All members with restricted roles should have the Community Member
 	// role by default if someone hasn't done the process incorrectly, so
 	// we can assume they are in the cache
-	cachedMember, exists := memberCache.Get(m.User.ID)
+	member, exists := memberCache.Get(m.User.ID)
 	if !exists {
 		log.Printf("Member %s not found in cache", m.User.ID)
 		return
 	}
-
-	member, ok := cachedMember.(*discordgo.Member)
-	if !ok {
-		log.Printf("Cached member %s is not of type *discordgo.Member", m.User.ID)
-		return
-	}
 	log.Printf("Processing leave event for member %s with cached roles: %v", m.User.ID, member.Roles)
+	recordDeparture(m.User, member.Roles)
 
 	// Check if the user has any restricted roles
 	for _, role := range member.Roles {
@@ -373,17 +274,22 @@ func OnMemberLeave(s *discordgo.Session, m *discordgo.GuildMemberRemove) {
 			rolesMention += "<@&" + role + ">"
 		}
 
-		_, err := s.ChannelMessageSendComplex(accessControlChannelId, &discordgo.MessageSend{
+		send := &discordgo.MessageSend{
 			Content: rolesMention,
 			Embeds:  []*discordgo.MessageEmbed{embed},
-		})
+		}
+		if id, checklist := newLeaveChecklist(m.User.ID, rolesToPing); checklist != nil {
+			embed.Fields = append(embed.Fields, checklist.field())
+			send.Components = checklist.components(id)
+		}
+		_, err := s.ChannelMessageSendComplex(accessControlChannelId, send)
 		if err != nil {
 			s.ChannelMessageSend(m.GuildID, "Error sending message to audit log channel")
 		}
 
 	}
 
-	_, err := s.ChannelMessageSend(auditLogChannelId, message)
+	_, err := sendAudit(s, AuditLeaves, "", &discordgo.MessageSend{Content: message})
 	if err != nil {
 		s.ChannelMessageSend(m.GuildID, "Error sending message to audit log channel")
 	}
@@ -395,24 +301,20 @@ func OnMemberLeave(s *discordgo.Session, m *discordgo.GuildMemberRemove) {
 
 func OnMessageCreate(s *discordgo.Session, m *discordgo.MessageCreate) {
 	messageCache.Add(m.ID, m.Message)
-}
-
-func OnMessageUpdate(s *discordgo.Session, m *discordgo.MessageUpdate) {
-	messageCache.Add(m.ID, m.Message)
+	go archiveAttachments(m.Message)
+	guardMentions(s, m)
 }
 
 func OnMessageDelete(s *discordgo.Session, m *discordgo.MessageDelete) {
-	auditLogChannelId = viper.GetString("auditLogChannelId")
 	deletedMessage, exists := messageCache.Get(m.ID)
 	if !exists {
 		// If message not cached, we can't check the author, so proceed normally
-		messageToLog = "Message was not cached, unable to retrieve message content"
-		embed = &discordgo.MessageEmbed{
+		embed := &discordgo.MessageEmbed{
 			Title: "Message Deleted",
 			Fields: []*discordgo.MessageEmbedField{
 				{
 					Name:  "Channel",
-					Value: "<#" + m.ChannelID + ">",
+					Value: channelContext(s, m.ChannelID),
 				},
 				{
 					Name:  "Author",
@@ -420,41 +322,149 @@ func OnMessageDelete(s *discordgo.Session, m *discordgo.MessageDelete) {
 				},
 				{
 					Name:  "Message",
-					Value: messageToLog,
+					Value: "Message was not cached, unable to retrieve message content",
 				},
 			},
 		}
-	} else {
-		// Check if the author is the ticket bot and skip if so
-		if deletedMessage.(*discordgo.Message).Author.ID == viper.GetString("ticketBotUserId") {
-			return
+		_, err := sendAudit(s, AuditMessageDeletes, m.ChannelID, &discordgo.MessageSend{
+			Embeds: []*discordgo.MessageEmbed{embed},
+		})
+		if err != nil {
+			s.ChannelMessageSend(m.GuildID, "Error sending message to audit log channel")
 		}
+		return
+	}
 
-		messageToLog = deletedMessage.(*discordgo.Message).Content
-		embed = &discordgo.MessageEmbed{
-			Title: "Message Deleted",
-			Fields: []*discordgo.MessageEmbedField{
-				{
-					Name:  "Channel",
-					Value: "<#" + m.ChannelID + ">",
-				},
-				{
-					Name:  "Author",
-					Value: "<@" + deletedMessage.(*discordgo.Message).Author.ID + ">" + " (" + deletedMessage.(*discordgo.Message).Author.Username + ")",
-				},
-				{
-					Name:  "Message",
-					Value: messageToLog,
-				},
-			},
-		}
+	messageCache.Remove(m.ID)
+	defer removeArchivedAttachments(deletedMessage)
+
+	// Check if the author is the ticket bot and skip if so
+	if deletedMessage.Author.ID == viper.GetString("ticketBotUserId") {
+		return
 	}
 
-	// Send a message to the audit log channel
-	_, err := s.ChannelMessageSendComplex(auditLogChannelId, &discordgo.MessageSend{
+	// History keeps where the message was, its content only goes to the audit log
+	recordHistory(deletedMessage.Author.ID, HistoryMessageDeleted, "",
+		"Message "+deletedMessage.ID+" deleted in <#"+deletedMessage.ChannelID+">")
+
+	files, closeFiles := archivedAttachmentFiles(deletedMessage)
+	defer closeFiles()
+
+	embed := deletedMessageEmbed(s, deletedMessage, m.GuildID)
+	_, err := sendAudit(s, AuditMessageDeletes, m.ChannelID, &discordgo.MessageSend{
 		Embeds: []*discordgo.MessageEmbed{embed},
+		Files:  files,
 	})
+	if err != nil && len(files) > 0 {
+		// The archived files may be over the upload limits, the embed
+		// still links the original attachments
+		log.Printf("Error re-uploading attachments of deleted message %s: %v", m.ID, err)
+		embed.Footer = &discordgo.MessageEmbedFooter{Text: "Archived attachments could not be re-uploaded"}
+		_, err = sendAudit(s, AuditMessageDeletes, m.ChannelID, &discordgo.MessageSend{
+			Embeds: []*discordgo.MessageEmbed{embed},
+		})
+	}
 	if err != nil {
+		log.Printf("Error sending message delete audit log: %v", err)
 		s.ChannelMessageSend(m.GuildID, "Error sending message to audit log channel")
 	}
 }
+
+// deletedMessageEmbed describes a deleted message, splitting long content
+// across fields and listing attachments, stickers and reply context
+func deletedMessageEmbed(s *discordgo.Session, msg *discordgo.Message, guildId string) *discordgo.MessageEmbed {
+	fields := []*discordgo.MessageEmbedField{
+		{
+			Name:  "Channel",
+			Value: channelContext(s, msg.ChannelID),
+		},
+		{
+			Name:  "Author",
+			Value: "<@" + msg.Author.ID + ">" + " (" + msg.Author.Username + ")",
+		},
+	}
+
+	if ref := msg.MessageReference; ref != nil && ref.MessageID != "" {
+		replyTo := "https://discord.com/channels/" + guildId + "/" + ref.ChannelID + "/" + ref.MessageID
+		if msg.ReferencedMessage != nil && msg.ReferencedMessage.Author != nil {
+			replyTo += " (<@" + msg.ReferencedMessage.Author.ID + ">)"
+		}
+		fields = append(fields, &discordgo.MessageEmbedField{
+			Name:  "Reply To",
+			Value: replyTo,
+		})
+	}
+
+	chunks := splitText(msg.Content, embedFieldLimit)
+	for idx, chunk := range chunks {
+		name := "Message"
+		if len(chunks) > 1 {
+			name = fmt.Sprintf("Message (%d/%d)", idx+1, len(chunks))
+		}
+		fields = append(fields, &discordgo.MessageEmbedField{
+			Name:  name,
+			Value: chunk,
+		})
+	}
+
+	if len(msg.Attachments) > 0 {
+		var attachments []string
+		for _, attachment := range msg.Attachments {
+			attachments = append(attachments, fmt.Sprintf("[%s](%s) (%d KB)", attachment.Filename, attachment.URL, attachment.Size/1024))
+		}
+		fields = append(fields, &discordgo.MessageEmbedField{
+			Name:  "Attachments",
+			Value: truncateList(attachments, embedFieldLimit),
+		})
+	}
+
+	if len(msg.StickerItems) > 0 {
+		var stickers []string
+		for _, sticker := range msg.StickerItems {
+			stickers = append(stickers, sticker.Name)
+		}
+		fields = append(fields, &discordgo.MessageEmbedField{
+			Name:  "Stickers",
+			Value: truncateList(stickers, embedFieldLimit),
+		})
+	}
+
+	return &discordgo.MessageEmbed{
+		Title:  "Message Deleted",
+		Fields: fields,
+	}
+}
+
+// channelContext mentions a channel, including the parent channel when
+// it is a thread
+func channelContext(s *discordgo.Session, channelId string) string {
+	context := "<#" + channelId + ">"
+	if channel, err := s.State.Channel(channelId); err == nil && channel.IsThread() {
+		context += " (thread in <#" + channel.ParentID + ">)"
+	}
+	return context
+}
+
+// splitText splits text into chunks of at most limit bytes, preferring to
+// break on newlines or spaces and never splitting a UTF-8 character
+func splitText(text string, limit int) []string {
+	if strings.TrimSpace(text) == "" {
+		return []string{"*(no text content)*"}
+	}
+	var chunks []string
+	for len(text) > limit {
+		cut := strings.LastIndexAny(text[:limit], "\n ")
+		if cut <= 0 {
+			cut = limit
+			for cut > 0 && !isRuneStart(text[cut]) {
+				cut--
+			}
+		}
+		chunks = append(chunks, text[:cut])
+		text = strings.TrimLeft(text[cut:], "\n ")
+	}
+	if text != "" {
+		chunks = append(chunks, text)
+	}
+	return chunks
+}
@@ -0,0 +1,241 @@
+package events
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"djs-zth-utilities/storage"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/spf13/viper"
+)
+
+// Audit categories used to route audit entries to channels
+const (
+	AuditJoins          = "joins"
+	AuditLeaves         = "leaves"
+	AuditRoleChanges    = "roleChanges"
+	AuditMessageDeletes = "messageDeletes"
+	AuditMessageEdits   = "messageEdits"
+	AuditReports        = "reports"
+	AuditTickets        = "tickets"
+	AuditConfigChanges  = "configChanges"
+	AuditMemberUpdates  = "memberUpdates"
+	AuditServerChanges  = "serverChanges"
+	AuditVoice          = "voice"
+	AuditInfractions    = "infractions"
+	AuditModeration     = "moderation"
+)
+
+const configHashesKey = "configHashes"
+
+var auditMirrorMu sync.Mutex
+
+// auditRoute is a category's routing entry under auditRouting.categories
+type auditRoute struct {
+	ChannelID string `mapstructure:"channelId"`
+	Color     int    `mapstructure:"color"`
+}
+
+// auditSourceRoute sends a category's entries from specific source
+// channels to their own destination
+type auditSourceRoute struct {
+	SourceChannelIDs []string `mapstructure:"sourceChannelIds"`
+	Categories       []string `mapstructure:"categories"`
+	ChannelID        string   `mapstructure:"channelId"`
+}
+
+// auditMirrorLine is a single audit entry in the JSONL mirror file
+type auditMirrorLine struct {
+	Timestamp       string   `json:"timestamp"`
+	Category        string   `json:"category"`
+	SourceChannelID string   `json:"source_channel_id,omitempty"`
+	ChannelID       string   `json:"channel_id"`
+	Content         string   `json:"content,omitempty"`
+	Embeds          []string `json:"embeds,omitempty"`
+}
+
+// auditDestination picks the channel for an audit entry: a matching
+// source channel route first, then the category's channel, then the
+// category's default
+func auditDestination(category, sourceChannelId string) string {
+	if sourceChannelId != "" {
+		var sourceRoutes []auditSourceRoute
+		if err := viper.UnmarshalKey("auditRouting.sourceChannels", &sourceRoutes); err != nil {
+			log.Printf("Error reading auditRouting.sourceChannels: %v", err)
+		}
+		for _, route := range sourceRoutes {
+			if route.ChannelID == "" || !contains(route.SourceChannelIDs, sourceChannelId) {
+				continue
+			}
+			if len(route.Categories) == 0 || contains(route.Categories, category) {
+				return route.ChannelID
+			}
+		}
+	}
+
+	if route := auditRouteFor(category); route.ChannelID != "" {
+		return route.ChannelID
+	}
+	if category == AuditReports || category == AuditInfractions || category == AuditModeration {
+		return viper.GetString("moderationChannelId")
+	}
+	return viper.GetString("auditLogChannelId")
+}
+
+func auditRouteFor(category string) auditRoute {
+	var route auditRoute
+	if err := viper.UnmarshalKey("auditRouting.categories."+category, &route); err != nil {
+		log.Printf("Error reading auditRouting.categories.%s: %v", category, err)
+	}
+	return route
+}
+
+// Colors of audit entries that need attention, e.g. a new account
+// joining. sendAudit keeps them rather than applying the category color.
+const (
+	auditWarningColor = 0xFFA500
+	auditAlertColor   = 0xED4245
+)
+
+// sendAudit posts an audit entry to the channel routed for its category
+// and source channel, applying the category's embed color and mirroring
+// it to auditRouting.jsonlFile
+func sendAudit(s *discordgo.Session, category, sourceChannelId string, msg *discordgo.MessageSend) (*discordgo.Message, error) {
+	// Report cases are colored by their status, which is redrawn on every
+	// change anyway
+	if color := auditRouteFor(category).Color; color != 0 && category != AuditReports {
+		for _, embed := range msg.Embeds {
+			if embed.Color != auditWarningColor && embed.Color != auditAlertColor {
+				embed.Color = color
+			}
+		}
+	}
+	channelId := auditDestination(category, sourceChannelId)
+	mirrorAudit(category, sourceChannelId, channelId, msg)
+	return s.ChannelMessageSendComplex(channelId, msg)
+}
+
+func mirrorAudit(category, sourceChannelId, channelId string, msg *discordgo.MessageSend) {
+	path := viper.GetString("auditRouting.jsonlFile")
+	if path == "" {
+		return
+	}
+	line := auditMirrorLine{
+		Timestamp:       time.Now().Format(time.RFC3339),
+		Category:        category,
+		SourceChannelID: sourceChannelId,
+		ChannelID:       channelId,
+		Content:         msg.Content,
+	}
+	for _, embed := range msg.Embeds {
+		line.Embeds = append(line.Embeds, embedText(embed))
+	}
+	data, err := json.Marshal(line)
+	if err != nil {
+		log.Printf("Error encoding audit mirror line: %v", err)
+		return
+	}
+
+	auditMirrorMu.Lock()
+	defer auditMirrorMu.Unlock()
+	if dir := filepath.Dir(path); dir != "." {
+		os.MkdirAll(dir, 0o755)
+	}
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		log.Printf("Error opening audit mirror file: %v", err)
+		return
+	}
+	defer file.Close()
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		log.Printf("Error writing audit mirror file: %v", err)
+	}
+}
+
+// ReportConfigChanges audits which config keys changed since the bot last
+// started. Only hashes of the values are stored and no values are posted
+// since the file holds secrets.
+func ReportConfigChanges(s *discordgo.Session) {
+	current := make(map[string]string)
+	for key, value := range flattenSettings("", viper.AllSettings()) {
+		sum := sha256.Sum256([]byte(fmt.Sprintf("%v", value)))
+		current[key] = hex.EncodeToString(sum[:])
+	}
+
+	var previous map[string]string
+	found, err := storage.Get(botStateBucket, configHashesKey, &previous)
+	if err != nil {
+		log.Printf("Error reading config hashes: %v", err)
+		return
+	}
+	if err := storage.Put(botStateBucket, configHashesKey, current); err != nil {
+		log.Printf("Error storing config hashes: %v", err)
+	}
+	// Nothing to compare against on the first start
+	if !found {
+		return
+	}
+
+	var changed []string
+	for key, hash := range current {
+		if previous[key] != hash {
+			changed = append(changed, key)
+		}
+	}
+	for key := range previous {
+		if _, exists := current[key]; !exists {
+			changed = append(changed, key)
+		}
+	}
+	if len(changed) == 0 {
+		return
+	}
+	sort.Strings(changed)
+	log.Printf("Configuration changed since last start: %s", strings.Join(changed, ", "))
+
+	embed := &discordgo.MessageEmbed{
+		Title:     "Configuration Changed",
+		Color:     0x9B59B6,
+		Timestamp: time.Now().Format(time.RFC3339),
+		Fields: []*discordgo.MessageEmbedField{
+			{
+				Name:  fmt.Sprintf("Changed Keys (%d)", len(changed)),
+				Value: truncateList(changed, embedFieldLimit),
+			},
+		},
+	}
+	_, err = sendAudit(s, AuditConfigChanges, "", &discordgo.MessageSend{
+		Embeds: []*discordgo.MessageEmbed{embed},
+	})
+	if err != nil {
+		log.Printf("Error sending config change audit log: %v", err)
+	}
+}
+
+// flattenSettings turns nested settings into dotted keys
+func flattenSettings(prefix string, settings map[string]interface{}) map[string]interface{} {
+	flat := make(map[string]interface{})
+	for key, value := range settings {
+		if prefix != "" {
+			key = prefix + "." + key
+		}
+		if nested, ok := value.(map[string]interface{}); ok {
+			for k, v := range flattenSettings(key, nested) {
+				flat[k] = v
+			}
+			continue
+		}
+		flat[key] = value
+	}
+	return flat
+}
@@ -0,0 +1,92 @@
+package events
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// OnMessageDeleteBulk records a purge as one audit entry with every cached
+// message attached as a text file
+func OnMessageDeleteBulk(s *discordgo.Session, m *discordgo.MessageDeleteBulk) {
+	var deleted []*discordgo.Message
+	for _, id := range m.Messages {
+		msg, exists := messageCache.Get(id)
+		if !exists {
+			continue
+		}
+		deleted = append(deleted, msg)
+		messageCache.Remove(id)
+	}
+	sort.Slice(deleted, func(i, j int) bool {
+		return deleted[i].Timestamp.Before(deleted[j].Timestamp)
+	})
+
+	var transcript bytes.Buffer
+	for _, msg := range deleted {
+		author := "Unknown"
+		if msg.Author != nil {
+			author = msg.Author.Username + " (" + msg.Author.ID + ")"
+		}
+		fmt.Fprintf(&transcript, "[%s] %s: %s\n", msg.Timestamp.Format(time.RFC3339), author, msg.Content)
+		for _, attachment := range msg.Attachments {
+			fmt.Fprintf(&transcript, "    attachment: %s\n", attachment.URL)
+		}
+		removeArchivedAttachments(msg)
+	}
+
+	embed := &discordgo.MessageEmbed{
+		Title:     "Messages Bulk Deleted",
+		Color:     0xFF0000,
+		Timestamp: time.Now().Format(time.RFC3339),
+		Fields: []*discordgo.MessageEmbedField{
+			{
+				Name:   "Channel",
+				Value:  channelContext(s, m.ChannelID),
+				Inline: true,
+			},
+			{
+				Name:   "Messages",
+				Value:  fmt.Sprintf("%d deleted, %d cached", len(m.Messages), len(deleted)),
+				Inline: true,
+			},
+			{
+				Name:   "Deleted By",
+				Value:  bulkDeleteModerator(s, m.GuildID, m.ChannelID),
+				Inline: true,
+			},
+		},
+	}
+
+	send := &discordgo.MessageSend{
+		Embeds: []*discordgo.MessageEmbed{embed},
+	}
+	if transcript.Len() > 0 {
+		send.Files = []*discordgo.File{
+			{
+				Name:        "bulk-delete-" + m.ChannelID + "-" + strconv.FormatInt(time.Now().Unix(), 10) + ".txt",
+				ContentType: "text/plain",
+				Reader:      &transcript,
+			},
+		}
+	}
+	_, err := sendAudit(s, AuditMessageDeletes, m.ChannelID, send)
+	if err != nil {
+		log.Printf("Error sending bulk delete audit log: %v", err)
+	}
+}
+
+// bulkDeleteModerator finds who purged the channel from its audit log
+// entry
+func bulkDeleteModerator(s *discordgo.Session, guildId, channelId string) string {
+	entry := recentAuditEntry(s, guildId, channelId, "", []discordgo.AuditLogAction{discordgo.AuditLogActionMessageBulkDelete})
+	if entry == nil {
+		return "Unknown"
+	}
+	return "<@" + entry.UserID + ">"
+}
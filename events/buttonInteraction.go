@@ -41,6 +41,9 @@ func RoleButtonInteractionCreate(s *discordgo.Session, i *discordgo.InteractionC
 				return
 			}
 
+			// Credit the approver rather than the bot in the audit log
+			TrackRoleCommand(targetUserID, i.Member.User.ID, roleID)
+
 			// Add the role to the user
 			err = s.GuildMemberRoleAdd(i.GuildID, targetUserID, roleID)
 			if err != nil {
@@ -161,6 +164,9 @@ func RoleButtonInteractionCreate(s *discordgo.Session, i *discordgo.InteractionC
 				return
 			}
 
+			// Credit the approver rather than the bot in the audit log
+			TrackRoleCommand(targetUserID, i.Member.User.ID, roleID)
+
 			// Remove the role from the user
 			err = s.GuildMemberRoleRemove(i.GuildID, targetUserID, roleID)
 			if err != nil {
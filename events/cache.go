@@ -2,38 +2,131 @@ package events
 
 import (
 	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/bwmarrin/discordgo"
-	lru "github.com/hashicorp/golang-lru"
 )
 
-func init() {
-	var err error
-	messageCache, err = lru.New(1000)
-	if err != nil {
-		log.Fatalf("Error creating message cache: %s", err)
+// MemberCache holds every guild member, kept up to date from gateway
+// member chunks and join, leave and update events. Members are never
+// evicted while they are in the guild.
+type MemberCache struct {
+	mu      sync.RWMutex
+	members map[string]*discordgo.Member
+}
+
+var memberCache = &MemberCache{members: make(map[string]*discordgo.Member)}
+
+// Members returns the guild member cache
+func Members() *MemberCache {
+	return memberCache
+}
+
+// Add stores or replaces a member
+func (c *MemberCache) Add(member *discordgo.Member) {
+	if member == nil || member.User == nil {
+		return
 	}
-	memberCache, err = lru.New(3000)
+	c.mu.Lock()
+	c.members[member.User.ID] = member
+	c.mu.Unlock()
+}
+
+// Remove drops a member who has left the guild
+func (c *MemberCache) Remove(userId string) {
+	c.mu.Lock()
+	delete(c.members, userId)
+	c.mu.Unlock()
+}
+
+// Get returns a member by user ID
+func (c *MemberCache) Get(userId string) (*discordgo.Member, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	member, exists := c.members[userId]
+	return member, exists
+}
+
+// Len returns the number of cached members
+func (c *MemberCache) Len() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return len(c.members)
+}
+
+// All returns every cached member
+func (c *MemberCache) All() []*discordgo.Member {
+	return c.filter(func(*discordgo.Member) bool { return true })
+}
+
+// WithRole returns every member that has the role
+func (c *MemberCache) WithRole(roleId string) []*discordgo.Member {
+	return c.filter(func(member *discordgo.Member) bool {
+		return contains(member.Roles, roleId)
+	})
+}
+
+// ByNickname returns members whose server nickname, display name or
+// username matches name, ignoring case
+func (c *MemberCache) ByNickname(name string) []*discordgo.Member {
+	name = strings.TrimSpace(name)
+	return c.filter(func(member *discordgo.Member) bool {
+		return strings.EqualFold(member.Nick, name) ||
+			strings.EqualFold(member.User.GlobalName, name) ||
+			strings.EqualFold(member.User.Username, name)
+	})
+}
+
+// filter returns matching members sorted by username
+func (c *MemberCache) filter(match func(*discordgo.Member) bool) []*discordgo.Member {
+	c.mu.RLock()
+	var members []*discordgo.Member
+	for _, member := range c.members {
+		if match(member) {
+			members = append(members, member)
+		}
+	}
+	c.mu.RUnlock()
+	sort.Slice(members, func(i, j int) bool {
+		return members[i].User.Username < members[j].User.Username
+	})
+	return members
+}
+
+// GetMember returns a member from the cache, falling back to the API for
+// members the cache hasn't seen yet
+func GetMember(s *discordgo.Session, guildId, userId string) (*discordgo.Member, error) {
+	if member, exists := memberCache.Get(userId); exists {
+		return member, nil
+	}
+	member, err := s.GuildMember(guildId, userId)
 	if err != nil {
-		log.Fatalf("Error creating member cache: %s", err)
+		return nil, err
 	}
+	memberCache.Add(member)
+	return member, nil
 }
 
+// CacheGuildMembers asks the gateway for every guild member. Members
+// arrive in chunks handled by OnGuildMembersChunk.
 func CacheGuildMembers(s *discordgo.Session, guildId string) {
-	var after string
-	for {
-		members, err := s.GuildMembers(guildId, after, 1000)
-		if err != nil {
-			log.Printf("Error fetching guild members: %s", err)
-		}
-		if len(members) == 0 {
-			break
-		}
-		for _, member := range members {
-			memberCache.Add(member.User.ID, member)
-			log.Printf("Cached member: %s", member.User.ID)
-		}
-		after = members[len(members)-1].User.ID
+	nonce := "member-cache-" + strconv.FormatInt(time.Now().UnixNano(), 10)
+	err := s.RequestGuildMembers(guildId, "", 0, nonce, false)
+	if err != nil {
+		log.Printf("Error requesting guild members: %s", err)
+	}
+}
+
+func OnGuildMembersChunk(s *discordgo.Session, c *discordgo.GuildMembersChunk) {
+	for _, member := range c.Members {
+		memberCache.Add(member)
+	}
+	if c.ChunkIndex == c.ChunkCount-1 {
+		log.Printf("Member cache synchronized with %d members", memberCache.Len())
+		SetMemberCount(s, &discordgo.Guild{ID: c.GuildID})
 	}
-	SetMemberCount(s, &discordgo.Guild{ID: guildId})
 }
@@ -2,15 +2,13 @@ package events
 
 import (
 	"log"
-	"sync"
+
+	"djs-zth-utilities/wow"
 
 	"github.com/bwmarrin/discordgo"
 	"github.com/spf13/viper"
 )
 
-var processedThreads = make(map[string]bool)
-var mu sync.Mutex
-
 func newDJsAppPing(s *discordgo.Session, thread *discordgo.Channel) {
 	// When a new app is submitted to the DJs App Forum channel, the bot
 	// will ping the DJs Member Role in the new forum post
@@ -37,6 +35,34 @@ func pinDJAppEmbed(s *discordgo.Session, threadId string) {
 	}
 }
 
+// postDJAppInviteInfo posts the normalized character and invite command
+// for applications that include a character name and realm
+func postDJAppInviteInfo(s *discordgo.Session, threadId string) {
+	messages, err := s.ChannelMessages(threadId, 1, "", "", "")
+	if err != nil {
+		log.Println("Error fetching messages:", err)
+		return
+	}
+	if len(messages) == 0 {
+		return
+	}
+	for _, appEmbed := range messages[0].Embeds {
+		characterName, realm, _ := characterFromEmbedFields(appEmbed.Fields)
+		if characterName == "" || realm == "" {
+			continue
+		}
+		character := wow.NormalizeCharacter(characterName, realm)
+		_, err = s.ChannelMessageSendEmbed(threadId, &discordgo.MessageEmbed{
+			Title:  "Copy & Paste for Inviters",
+			Fields: inviteEmbedFields(character),
+		})
+		if err != nil {
+			log.Println("Error sending application invite embed:", err)
+		}
+		return
+	}
+}
+
 func addLabelToThread(s *discordgo.Session, threadId string, label string) {
 	_, err := s.ChannelEditComplex(threadId, &discordgo.ChannelEdit{
 		AppliedTags: &[]string{label}, // Add the label to the thread
@@ -50,15 +76,23 @@ func addLabelToThread(s *discordgo.Session, threadId string, label string) {
 func OnDJsThreadCreate(s *discordgo.Session, t *discordgo.ThreadCreate) {
 	djsChannelId := viper.GetString("djsAppForumChannelId")
 	if t.ParentID == djsChannelId {
-		mu.Lock()
-		defer mu.Unlock()
+		processDJsApp(s, t.Channel)
+	}
+}
 
-		if _, exists := processedThreads[t.ID]; !exists {
-			// Run pinDJAppEmbed first to make sure it pins the embed
-			pinDJAppEmbed(s, t.ID)
-			newDJsAppPing(s, t.Channel)
-			addLabelToThread(s, t.ID, viper.GetString("djsAppLabel"))
-			processedThreads[t.ID] = true
-		}
+// processDJsApp pins, pings and labels a new application once, even if
+// the thread event is delivered again or caught up after a restart
+func processDJsApp(s *discordgo.Session, thread *discordgo.Channel) {
+	unlock := lockThread(thread.ID)
+	defer unlock()
+
+	if isProcessed("djsApp", thread.ID) {
+		return
 	}
+	// Run pinDJAppEmbed first to make sure it pins the embed
+	pinDJAppEmbed(s, thread.ID)
+	newDJsAppPing(s, thread)
+	postDJAppInviteInfo(s, thread.ID)
+	addLabelToThread(s, thread.ID, viper.GetString("djsAppLabel"))
+	markProcessed("djsApp", thread.ID)
 }
@@ -0,0 +1,225 @@
+package events
+
+import (
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+
+	"djs-zth-utilities/storage"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/spf13/viper"
+)
+
+const (
+	processedEventBucket = "processedEvents"
+	botStateBucket       = "botState"
+	lastSeenKey          = "lastSeen"
+)
+
+var (
+	threadLocks     = idLocks{locks: make(map[string]*idLock)}
+	eventLedgerOnce sync.Once
+
+	lastSeenOnce      sync.Once
+	lastSeenAtStartup time.Time
+	lastSeenFound     bool
+
+	disconnectMu   sync.Mutex
+	lastDisconnect time.Time
+)
+
+// idLocks hands out a mutex per ID, e.g. per thread, so handlers working on
+// the same ID are serialized without blocking handlers for other IDs
+type idLocks struct {
+	mu    sync.Mutex
+	locks map[string]*idLock
+}
+
+// idLock is a per-ID mutex that is dropped once nobody holds it
+type idLock struct {
+	sync.Mutex
+	refs int
+}
+
+// processedEvent is stored in the ledger once an event has been handled
+type processedEvent struct {
+	ProcessedAt time.Time `json:"processed_at"`
+}
+
+// lockThread serializes handlers working on the same thread without
+// blocking handlers for other threads. Call the returned func to unlock.
+func lockThread(threadId string) func() {
+	return threadLocks.lock(threadId)
+}
+
+// lock locks the mutex for an ID. Call the returned func to unlock.
+func (l *idLocks) lock(id string) func() {
+	l.mu.Lock()
+	lock, exists := l.locks[id]
+	if !exists {
+		lock = &idLock{}
+		l.locks[id] = lock
+	}
+	lock.refs++
+	l.mu.Unlock()
+
+	lock.Lock()
+	return func() {
+		lock.Unlock()
+		l.mu.Lock()
+		lock.refs--
+		if lock.refs == 0 {
+			delete(l.locks, id)
+		}
+		l.mu.Unlock()
+	}
+}
+
+// isProcessed reports whether an event has already been handled
+func isProcessed(kind, id string) bool {
+	var event processedEvent
+	found, err := storage.Get(processedEventBucket, kind+":"+id, &event)
+	if err != nil {
+		log.Printf("Error reading processed event %s:%s: %v", kind, id, err)
+	}
+	return found
+}
+
+// markProcessed records that an event has been handled
+func markProcessed(kind, id string) {
+	err := storage.Put(processedEventBucket, kind+":"+id, processedEvent{ProcessedAt: time.Now()})
+	if err != nil {
+		log.Printf("Error storing processed event %s:%s: %v", kind, id, err)
+	}
+}
+
+// pruneProcessedEvents removes ledger entries older than
+// processedEventTTLHours
+func pruneProcessedEvents() {
+	ttl := time.Duration(viper.GetInt("processedEventTTLHours")) * time.Hour
+	if ttl <= 0 {
+		ttl = 30 * 24 * time.Hour
+	}
+	removed, err := storage.DeleteWhere(processedEventBucket, func(key string, value []byte) bool {
+		var event processedEvent
+		if err := json.Unmarshal(value, &event); err != nil {
+			return true
+		}
+		return time.Since(event.ProcessedAt) > ttl
+	})
+	if err != nil {
+		log.Printf("Error pruning processed events: %v", err)
+		return
+	}
+	if removed > 0 {
+		log.Printf("Pruned %d expired processed events", removed)
+	}
+}
+
+// StartEventLedger catches up on ticket and application threads created
+// while the bot was offline, then keeps the ledger pruned and records
+// when the bot was last online
+func StartEventLedger(s *discordgo.Session) {
+	eventLedgerOnce.Do(func() {
+		lastSeen, found := previousLastSeen()
+		pruneProcessedEvents()
+		recordLastSeen()
+
+		if found {
+			go catchUpMissedThreads(s, lastSeen)
+		} else {
+			log.Println("No last seen time recorded, skipping thread catch-up")
+		}
+
+		go func() {
+			ticker := time.NewTicker(time.Minute)
+			defer ticker.Stop()
+			for tick := 0; ; tick++ {
+				<-ticker.C
+				recordLastSeen()
+				if tick%60 == 0 {
+					pruneProcessedEvents()
+				}
+			}
+		}()
+	})
+}
+
+// previousLastSeen returns when the bot was last online before it started,
+// read once before StartEventLedger starts overwriting it
+func previousLastSeen() (time.Time, bool) {
+	lastSeenOnce.Do(func() {
+		found, err := storage.Get(botStateBucket, lastSeenKey, &lastSeenAtStartup)
+		if err != nil {
+			log.Printf("Error reading last seen time: %v", err)
+		}
+		lastSeenFound = found
+	})
+	return lastSeenAtStartup, lastSeenFound
+}
+
+// lastOnline returns when the bot last lost its gateway connection, or
+// when it was last seen before it started if it hasn't lost it since
+func lastOnline() (time.Time, bool) {
+	disconnectMu.Lock()
+	disconnected := lastDisconnect
+	disconnectMu.Unlock()
+	if !disconnected.IsZero() {
+		return disconnected, true
+	}
+	return previousLastSeen()
+}
+
+// OnDisconnect records when the gateway connection dropped, so state
+// reconciled on reconnect is closed at that time
+func OnDisconnect(s *discordgo.Session, d *discordgo.Disconnect) {
+	disconnectMu.Lock()
+	lastDisconnect = time.Now()
+	disconnectMu.Unlock()
+	recordLastSeen()
+}
+
+func recordLastSeen() {
+	if err := storage.Put(botStateBucket, lastSeenKey, time.Now()); err != nil {
+		log.Printf("Error storing last seen time: %v", err)
+	}
+}
+
+// catchUpMissedThreads processes ticket and application threads created
+// since the bot was last seen that aren't in the ledger yet
+func catchUpMissedThreads(s *discordgo.Session, lastSeen time.Time) {
+	threads, err := s.GuildThreadsActive(viper.GetString("guildId"))
+	if err != nil {
+		log.Printf("Error fetching active threads for catch-up: %v", err)
+		return
+	}
+
+	// Allow for events that arrived shortly before the bot went down
+	// without being fully processed
+	since := lastSeen.Add(-5 * time.Minute)
+	ticketChannelId := viper.GetString("ticketChannelId")
+	djsChannelId := viper.GetString("djsAppForumChannelId")
+
+	var wg sync.WaitGroup
+	for _, thread := range threads.Threads {
+		created, err := discordgo.SnowflakeTimestamp(thread.ID)
+		if err != nil || created.Before(since) {
+			continue
+		}
+		switch thread.ParentID {
+		case ticketChannelId:
+			log.Printf("Catching up on ticket thread %s created while offline", thread.ID)
+			wg.Add(1)
+			go func(thread *discordgo.Channel) {
+				defer wg.Done()
+				processZthTicket(s, thread)
+			}(thread)
+		case djsChannelId:
+			log.Printf("Catching up on application thread %s created while offline", thread.ID)
+			processDJsApp(s, thread)
+		}
+	}
+	wg.Wait()
+}
@@ -0,0 +1,291 @@
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"djs-zth-utilities/storage"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/spf13/viper"
+)
+
+const (
+	infractionBucket        = "infractions"
+	infractionCounterBucket = "infractionCounter"
+)
+
+// Infraction is a warning given to a member by a moderator
+type Infraction struct {
+	ID           int       `json:"id"`
+	UserID       string    `json:"user_id"`
+	ModeratorID  string    `json:"moderator_id"`
+	Reason       string    `json:"reason"`
+	CaseID       int       `json:"case_id,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+	PardonedBy   string    `json:"pardoned_by,omitempty"`
+	PardonedAt   time.Time `json:"pardoned_at,omitempty"`
+	PardonReason string    `json:"pardon_reason,omitempty"`
+}
+
+// escalationStep is an action taken when a member reaches a number of
+// active warnings, e.g. a timeout at 3 and a kick recommendation at 5
+type escalationStep struct {
+	Warnings        int    `mapstructure:"warnings"`
+	Action          string `mapstructure:"action"`
+	DurationMinutes int    `mapstructure:"durationMinutes"`
+}
+
+// infractionKey groups a member's infractions, oldest first
+func infractionKey(userId string, id int) string {
+	return fmt.Sprintf("%s/%010d", userId, id)
+}
+
+// Active reports whether the warning still counts towards escalation: it
+// hasn't been pardoned or expired after infractions.expireDays
+func (inf Infraction) Active() bool {
+	if inf.PardonedBy != "" {
+		return false
+	}
+	days := viper.GetInt("infractions.expireDays")
+	return days <= 0 || time.Since(inf.CreatedAt) < time.Duration(days)*24*time.Hour
+}
+
+// Infractions returns a member's infractions, oldest first
+func Infractions(userId string) ([]Infraction, error) {
+	var infractions []Infraction
+	err := storage.ForEach(infractionBucket, userId+"/", func(key string, value []byte) error {
+		var inf Infraction
+		if err := json.Unmarshal(value, &inf); err != nil {
+			log.Printf("Error decoding infraction %s: %v", key, err)
+			return nil
+		}
+		infractions = append(infractions, inf)
+		return nil
+	})
+	return infractions, err
+}
+
+// activeWarnings counts a member's warnings that still count
+func activeWarnings(userId string) int {
+	infractions, err := Infractions(userId)
+	if err != nil {
+		log.Printf("Error reading infractions for %s: %v", userId, err)
+	}
+	count := 0
+	for _, inf := range infractions {
+		if inf.Active() {
+			count++
+		}
+	}
+	return count
+}
+
+// Warn records a warning, DMs the member, logs it and applies any
+// escalation step the member has reached
+func Warn(s *discordgo.Session, guildId string, user *discordgo.User, moderatorId, reason string, caseId int) (*Infraction, error) {
+	var id int
+	err := storage.Update(infractionCounterBucket, "next", &id, func(found bool) error {
+		id++
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	inf := &Infraction{
+		ID:          id,
+		UserID:      user.ID,
+		ModeratorID: moderatorId,
+		Reason:      reason,
+		CaseID:      caseId,
+		CreatedAt:   time.Now(),
+	}
+	if err := storage.Put(infractionBucket, infractionKey(user.ID, id), inf); err != nil {
+		return nil, err
+	}
+	active := activeWarnings(user.ID)
+
+	summary := fmt.Sprintf("Warning #%d: %s", id, reason)
+	if caseId != 0 {
+		summary += fmt.Sprintf(" (report case #%d)", caseId)
+	}
+	recordHistory(user.ID, HistoryWarning, "<@"+moderatorId+">", summary)
+
+	_, err = sendDM(s, user.ID, &discordgo.MessageSend{
+		Embeds: []*discordgo.MessageEmbed{
+			{
+				Title:       "Warning",
+				Description: "You have received a warning from the moderators. Please review the server rules.",
+				Color:       0xFF9900,
+				Fields: []*discordgo.MessageEmbedField{
+					{
+						Name:  "Reason",
+						Value: TruncateText(reason, embedFieldLimit),
+					},
+				},
+			},
+		},
+	})
+	dmStatus := "Sent"
+	if err != nil {
+		log.Printf("Error sending warning DM to %s: %v", user.ID, err)
+		dmStatus = "Failed, the member may have DMs turned off"
+	}
+
+	embed := &discordgo.MessageEmbed{
+		Title:       fmt.Sprintf("Member Warned (#%d)", id),
+		Description: "<@" + user.ID + "> (" + user.Username + ") was warned by <@" + moderatorId + ">",
+		Color:       0xFF9900,
+		Fields: []*discordgo.MessageEmbedField{
+			{
+				Name:  "Reason",
+				Value: TruncateText(reason, embedFieldLimit),
+			},
+			{
+				Name:   "Active Warnings",
+				Value:  fmt.Sprint(active),
+				Inline: true,
+			},
+			{
+				Name:   "DM",
+				Value:  dmStatus,
+				Inline: true,
+			},
+		},
+	}
+	if caseId != 0 {
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+			Name:   "Report Case",
+			Value:  fmt.Sprintf("#%d", caseId),
+			Inline: true,
+		})
+	}
+	content := ""
+	if step, ok := escalationFor(active); ok {
+		var escalation string
+		escalation, content = escalate(s, guildId, user.ID, moderatorId, step, active)
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+			Name:  "Escalation",
+			Value: escalation,
+		})
+	}
+	_, err = sendAudit(s, AuditInfractions, "", &discordgo.MessageSend{
+		Content: content,
+		Embeds:  []*discordgo.MessageEmbed{embed},
+	})
+	if err != nil {
+		log.Printf("Error sending warning to audit log: %v", err)
+	}
+	return inf, nil
+}
+
+// escalationFor returns the step configured under infractions.escalation
+// for exactly this many active warnings, so each step only fires once
+func escalationFor(active int) (escalationStep, bool) {
+	var steps []escalationStep
+	if err := viper.UnmarshalKey("infractions.escalation", &steps); err != nil {
+		log.Printf("Error reading infractions.escalation: %v", err)
+	}
+	for _, step := range steps {
+		if step.Warnings == active {
+			return step, true
+		}
+	}
+	return escalationStep{}, false
+}
+
+// escalate applies a timeout step, or pings moderators to recommend a kick
+// or ban, returning what happened and the audit message content
+func escalate(s *discordgo.Session, guildId, userId, moderatorId string, step escalationStep, active int) (string, string) {
+	moderatorPing := "<@&" + viper.GetString("moderatorRoleId") + ">"
+	switch strings.ToLower(step.Action) {
+	case "timeout":
+		duration := time.Duration(step.DurationMinutes) * time.Minute
+		if duration <= 0 {
+			duration = time.Hour
+		}
+		until := time.Now().Add(duration)
+		reason := fmt.Sprintf("Reached %d active warnings", active)
+		TrackTimeoutCommand(userId, moderatorId)
+		err := s.GuildMemberTimeout(guildId, userId, &until, discordgo.WithAuditLogReason(reason))
+		if err != nil {
+			log.Printf("Error timing out %s: %v", userId, err)
+			return "Failed to time out for " + formatDuration(duration) + " after " + plural(active, "warning"), moderatorPing
+		}
+		return "Timed out for " + formatDuration(duration) + " after " + plural(active, "warning"), ""
+	case "kick", "ban":
+		return fmt.Sprintf("Reached %s, a %s is recommended", plural(active, "warning"), strings.ToLower(step.Action)), moderatorPing
+	}
+	log.Printf("Unknown escalation action %q", step.Action)
+	return "Reached " + plural(active, "warning"), moderatorPing
+}
+
+// Pardon lifts a warning so it no longer counts towards escalation. With
+// id 0 the member's most recent active warning is pardoned.
+func Pardon(s *discordgo.Session, userId string, id int, moderatorId, reason string) (*Infraction, error) {
+	if id == 0 {
+		infractions, err := Infractions(userId)
+		if err != nil {
+			return nil, err
+		}
+		for idx := len(infractions) - 1; idx >= 0; idx-- {
+			if infractions[idx].Active() {
+				id = infractions[idx].ID
+				break
+			}
+		}
+		if id == 0 {
+			return nil, fmt.Errorf("<@%s> has no active warnings", userId)
+		}
+	}
+
+	var inf Infraction
+	err := storage.Update(infractionBucket, infractionKey(userId, id), &inf, func(found bool) error {
+		if !found {
+			return fmt.Errorf("<@%s> has no warning #%d", userId, id)
+		}
+		if inf.PardonedBy != "" {
+			return fmt.Errorf("warning #%d was already pardoned", id)
+		}
+		inf.PardonedBy = moderatorId
+		inf.PardonedAt = time.Now()
+		inf.PardonReason = reason
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	recordHistory(userId, HistoryPardon, "<@"+moderatorId+">", fmt.Sprintf("Warning #%d pardoned: %s", id, orNone(reason)))
+	_, err = sendAudit(s, AuditInfractions, "", &discordgo.MessageSend{
+		Embeds: []*discordgo.MessageEmbed{
+			{
+				Title:       fmt.Sprintf("Warning Pardoned (#%d)", id),
+				Description: "<@" + moderatorId + "> pardoned a warning for <@" + userId + ">",
+				Color:       0x00ff00,
+				Fields: []*discordgo.MessageEmbedField{
+					{
+						Name:  "Original Reason",
+						Value: TruncateText(inf.Reason, embedFieldLimit),
+					},
+					{
+						Name:  "Pardon Reason",
+						Value: orNone(TruncateText(reason, embedFieldLimit)),
+					},
+					{
+						Name:   "Active Warnings",
+						Value:  fmt.Sprint(activeWarnings(userId)),
+						Inline: true,
+					},
+				},
+			},
+		},
+	})
+	if err != nil {
+		log.Printf("Error sending pardon to audit log: %v", err)
+	}
+	return &inf, nil
+}
@@ -0,0 +1,246 @@
+package events
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"djs-zth-utilities/storage"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/spf13/viper"
+)
+
+const (
+	leaveChecklistBucket = "leaveChecklists"
+	// Four rows of five buttons, leaving the last row for the close button
+	maxChecklistItems = 20
+)
+
+// leaveChecklist is the follow-up work for a member who left with
+// restricted roles, e.g. demoting them in the in-game guild
+type leaveChecklist struct {
+	UserID    string               `json:"user_id"`
+	Items     []leaveChecklistItem `json:"items"`
+	CreatedAt time.Time            `json:"created_at"`
+	ClosedBy  string               `json:"closed_by,omitempty"`
+	ClosedAt  time.Time            `json:"closed_at,omitempty"`
+}
+
+type leaveChecklistItem struct {
+	Action string    `json:"action"`
+	DoneBy string    `json:"done_by,omitempty"`
+	DoneAt time.Time `json:"done_at,omitempty"`
+}
+
+// leaveChecklistRole lists the actions for members who held a role
+type leaveChecklistRole struct {
+	RoleID  string   `mapstructure:"roleId"`
+	Actions []string `mapstructure:"actions"`
+}
+
+// leaveChecklistActions returns the configured actions for the restricted
+// roles a member held, without duplicates
+func leaveChecklistActions(roles []string) []string {
+	var roleActions []leaveChecklistRole
+	if err := viper.UnmarshalKey("leaveChecklist.roles", &roleActions); err != nil {
+		log.Printf("Error reading leaveChecklist.roles: %v", err)
+	}
+	actions := append([]string{}, viper.GetStringSlice("leaveChecklist.default")...)
+	for _, roleAction := range roleActions {
+		if contains(roles, roleAction.RoleID) {
+			actions = append(actions, roleAction.Actions...)
+		}
+	}
+
+	var unique []string
+	for _, action := range actions {
+		if action != "" && !contains(unique, action) {
+			unique = append(unique, action)
+		}
+	}
+	if len(unique) > maxChecklistItems {
+		log.Printf("Leave checklist has %d actions, only the first %d are shown", len(unique), maxChecklistItems)
+		unique = unique[:maxChecklistItems]
+	}
+	return unique
+}
+
+// newLeaveChecklist stores a checklist for a departed member and returns
+// its ID, or "" if no actions are configured for their roles
+func newLeaveChecklist(userId string, restrictedRoles []string) (string, *leaveChecklist) {
+	actions := leaveChecklistActions(restrictedRoles)
+	if len(actions) == 0 {
+		return "", nil
+	}
+	checklist := &leaveChecklist{UserID: userId, CreatedAt: time.Now()}
+	for _, action := range actions {
+		checklist.Items = append(checklist.Items, leaveChecklistItem{Action: action})
+	}
+	id := userId + "." + strconv.FormatInt(checklist.CreatedAt.Unix(), 10)
+	if err := storage.Put(leaveChecklistBucket, id, checklist); err != nil {
+		log.Printf("Error storing leave checklist for %s: %v", userId, err)
+		return "", nil
+	}
+	return id, checklist
+}
+
+// field renders the checklist's progress
+func (c *leaveChecklist) field() *discordgo.MessageEmbedField {
+	done := 0
+	lines := make([]string, len(c.Items))
+	for idx, item := range c.Items {
+		if item.DoneBy == "" {
+			lines[idx] = "⬜ " + item.Action
+			continue
+		}
+		done++
+		lines[idx] = fmt.Sprintf("✅ %s - <@%s> <t:%d:R>", item.Action, item.DoneBy, item.DoneAt.Unix())
+	}
+	value := strings.Join(lines, "\n")
+	if c.ClosedBy != "" {
+		value += fmt.Sprintf("\n\nClosed by <@%s> <t:%d:R>", c.ClosedBy, c.ClosedAt.Unix())
+	}
+	return &discordgo.MessageEmbedField{
+		Name:  fmt.Sprintf("Checklist (%d/%d)", done, len(c.Items)),
+		Value: TruncateText(value, embedFieldLimit),
+	}
+}
+
+// components renders a toggle button per item and a close button
+func (c *leaveChecklist) components(id string) []discordgo.MessageComponent {
+	if c.ClosedBy != "" {
+		return []discordgo.MessageComponent{}
+	}
+	var rows []discordgo.MessageComponent
+	var row []discordgo.MessageComponent
+	for idx, item := range c.Items {
+		style := discordgo.SecondaryButton
+		if item.DoneBy != "" {
+			style = discordgo.SuccessButton
+		}
+		row = append(row, discordgo.Button{
+			Label:    TruncateText(item.Action, 80),
+			Style:    style,
+			CustomID: fmt.Sprintf("leavecheck_item_%s_%d", id, idx),
+		})
+		if len(row) == 5 {
+			rows = append(rows, discordgo.ActionsRow{Components: row})
+			row = nil
+		}
+	}
+	if len(row) > 0 {
+		rows = append(rows, discordgo.ActionsRow{Components: row})
+	}
+	return append(rows, discordgo.ActionsRow{
+		Components: []discordgo.MessageComponent{
+			discordgo.Button{
+				Label:    "Close Checklist",
+				Style:    discordgo.DangerButton,
+				CustomID: "leavecheck_close_" + id,
+			},
+		},
+	})
+}
+
+// LeaveChecklistInteractionCreate marks checklist items done or not done
+// and closes checklists
+func LeaveChecklistInteractionCreate(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	if i.Type != discordgo.InteractionMessageComponent {
+		return
+	}
+	customID := i.MessageComponentData().CustomID
+	if !strings.HasPrefix(customID, "leavecheck_") {
+		return
+	}
+	parts := strings.Split(customID, "_")
+	if len(parts) < 3 {
+		return
+	}
+	id := parts[2]
+
+	if !HasApproverRole(i.Member) {
+		err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseChannelMessageWithSource,
+			Data: &discordgo.InteractionResponseData{
+				Content: "You do not have permission to update leave checklists.",
+				Flags:   discordgo.MessageFlagsEphemeral,
+			},
+		})
+		if err != nil {
+			log.Println("Error sending interaction response:", err)
+		}
+		return
+	}
+
+	var checklist leaveChecklist
+	err := storage.Update(leaveChecklistBucket, id, &checklist, func(found bool) error {
+		if !found {
+			return fmt.Errorf("leave checklist %s not found", id)
+		}
+		if checklist.ClosedBy != "" {
+			return nil
+		}
+		switch parts[1] {
+		case "item":
+			idx, err := strconv.Atoi(parts[len(parts)-1])
+			if err != nil || idx < 0 || idx >= len(checklist.Items) {
+				return fmt.Errorf("invalid checklist item in %s", customID)
+			}
+			item := &checklist.Items[idx]
+			if item.DoneBy == "" {
+				item.DoneBy = i.Member.User.ID
+				item.DoneAt = time.Now()
+			} else {
+				item.DoneBy = ""
+				item.DoneAt = time.Time{}
+			}
+		case "close":
+			checklist.ClosedBy = i.Member.User.ID
+			checklist.ClosedAt = time.Now()
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("Error updating leave checklist: %v", err)
+		err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseChannelMessageWithSource,
+			Data: &discordgo.InteractionResponseData{
+				Content: "Could not update this checklist, it may no longer be stored.",
+				Flags:   discordgo.MessageFlagsEphemeral,
+			},
+		})
+		if err != nil {
+			log.Println("Error sending interaction response:", err)
+		}
+		return
+	}
+
+	var embeds []*discordgo.MessageEmbed
+	if len(i.Message.Embeds) > 0 {
+		embed := i.Message.Embeds[0]
+		fields := make([]*discordgo.MessageEmbedField, 0, len(embed.Fields))
+		for _, field := range embed.Fields {
+			if !strings.HasPrefix(field.Name, "Checklist") {
+				fields = append(fields, field)
+			}
+		}
+		embed.Fields = append(fields, checklist.field())
+		if checklist.ClosedBy != "" {
+			embed.Color = 0x808080
+		}
+		embeds = []*discordgo.MessageEmbed{embed}
+	}
+	err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseUpdateMessage,
+		Data: &discordgo.InteractionResponseData{
+			Embeds:     embeds,
+			Components: checklist.components(id),
+		},
+	})
+	if err != nil {
+		log.Println("Error sending interaction response:", err)
+	}
+}
@@ -0,0 +1,77 @@
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"djs-zth-utilities/storage"
+)
+
+const historyBucket = "memberHistory"
+
+// Member history event kinds
+const (
+	HistoryJoin           = "join"
+	HistoryLeave          = "leave"
+	HistoryRoleAdded      = "roleAdded"
+	HistoryRoleRemoved    = "roleRemoved"
+	HistoryMessageDeleted = "messageDeleted"
+	HistoryReported       = "reported"
+	HistoryTicket         = "ticket"
+	HistoryProfileChange  = "profileChange"
+	HistoryTimeout        = "timeout"
+	HistoryWarning        = "warning"
+	HistoryPardon         = "pardon"
+	HistoryKick           = "kick"
+	HistoryBan            = "ban"
+)
+
+// HistoryEntry is a single event in a member's timeline. Actor is who
+// caused it, as a mention or a description such as "Unknown".
+type HistoryEntry struct {
+	Time    time.Time `json:"time"`
+	Kind    string    `json:"kind"`
+	Actor   string    `json:"actor,omitempty"`
+	Summary string    `json:"summary"`
+}
+
+// historyKey sorts a member's entries oldest first
+func historyKey(userId string, t time.Time) string {
+	return fmt.Sprintf("%s/%020d", userId, t.UnixNano())
+}
+
+// recordHistory adds an event to a member's timeline
+func recordHistory(userId, kind, actor, summary string) {
+	if userId == "" {
+		return
+	}
+	entry := HistoryEntry{
+		Time:    time.Now(),
+		Kind:    kind,
+		Actor:   actor,
+		Summary: summary,
+	}
+	if err := storage.Put(historyBucket, historyKey(userId, entry.Time), entry); err != nil {
+		log.Printf("Error recording %s history for %s: %v", kind, userId, err)
+	}
+}
+
+// MemberHistory returns a member's timeline, newest first
+func MemberHistory(userId string) ([]HistoryEntry, error) {
+	var entries []HistoryEntry
+	err := storage.ForEach(historyBucket, userId+"/", func(key string, value []byte) error {
+		var entry HistoryEntry
+		if err := json.Unmarshal(value, &entry); err != nil {
+			log.Printf("Error decoding history entry %s: %v", key, err)
+			return nil
+		}
+		entries = append(entries, entry)
+		return nil
+	})
+	for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
+		entries[i], entries[j] = entries[j], entries[i]
+	}
+	return entries, err
+}
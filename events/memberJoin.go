@@ -0,0 +1,228 @@
+package events
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"djs-zth-utilities/storage"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/spf13/viper"
+)
+
+const departureBucket = "departures"
+
+var (
+	inviteUses   = make(map[string]int)
+	inviteUsesMu sync.Mutex
+)
+
+// departureRecord is what a member looked like when they left, used to
+// flag them if they come back
+type departureRecord struct {
+	Username        string    `json:"username"`
+	Roles           []string  `json:"roles"`
+	RestrictedRoles []string  `json:"restricted_roles"`
+	LeftAt          time.Time `json:"left_at"`
+	Departures      int       `json:"departures"`
+}
+
+// restrictedRoleIds returns the roles that are pinged and put on the
+// leave checklist when a member leaves, both those that need approval to
+// be given and the approvedRoles
+func restrictedRoleIds() []string {
+	return append(viper.GetStringSlice("rolesRequiringApproval"), viper.GetStringSlice("approvedRoles")...)
+}
+
+// recordDeparture stores the roles a member had when they left
+func recordDeparture(user *discordgo.User, roles []string) {
+	var restricted []string
+	for _, role := range roles {
+		if contains(restrictedRoleIds(), role) {
+			restricted = append(restricted, role)
+		}
+	}
+	var record departureRecord
+	err := storage.Update(departureBucket, user.ID, &record, func(found bool) error {
+		record.Username = user.Username
+		record.Roles = roles
+		record.RestrictedRoles = restricted
+		record.LeftAt = time.Now()
+		record.Departures++
+		return nil
+	})
+	if err != nil {
+		log.Printf("Error recording departure for %s: %v", user.ID, err)
+	}
+}
+
+// SnapshotInvites records the current use count of every invite so the
+// invite a member joined with can be found
+func SnapshotInvites(s *discordgo.Session, guildId string) {
+	invites, err := s.GuildInvites(guildId)
+	if err != nil {
+		log.Printf("Error fetching invites: %v", err)
+		return
+	}
+	inviteUsesMu.Lock()
+	defer inviteUsesMu.Unlock()
+	inviteUses = make(map[string]int, len(invites))
+	for _, invite := range invites {
+		inviteUses[invite.Code] = invite.Uses
+	}
+}
+
+func OnInviteCreate(s *discordgo.Session, i *discordgo.InviteCreate) {
+	inviteUsesMu.Lock()
+	inviteUses[i.Code] = i.Uses
+	inviteUsesMu.Unlock()
+}
+
+func OnInviteDelete(s *discordgo.Session, i *discordgo.InviteDelete) {
+	inviteUsesMu.Lock()
+	delete(inviteUses, i.Code)
+	inviteUsesMu.Unlock()
+}
+
+// usedInvite compares invite use counts with the last snapshot to find the
+// invite a member just joined with. Returns nil if it can't be told apart,
+// e.g. a single-use invite that was deleted once used.
+func usedInvite(s *discordgo.Session, guildId string) *discordgo.Invite {
+	invites, err := s.GuildInvites(guildId)
+	if err != nil {
+		log.Printf("Error fetching invites: %v", err)
+		return nil
+	}
+	inviteUsesMu.Lock()
+	defer inviteUsesMu.Unlock()
+	var used []*discordgo.Invite
+	current := make(map[string]int, len(invites))
+	for _, invite := range invites {
+		current[invite.Code] = invite.Uses
+		if invite.Uses > inviteUses[invite.Code] {
+			used = append(used, invite)
+		}
+	}
+	inviteUses = current
+	if len(used) != 1 {
+		return nil
+	}
+	return used[0]
+}
+
+// memberJoinEmbed builds the audit entry for a new member
+func memberJoinEmbed(s *discordgo.Session, m *discordgo.GuildMemberAdd) *discordgo.MessageEmbed {
+	user := m.User
+	displayName := user.Username
+	if user.GlobalName != "" {
+		displayName = user.GlobalName
+	}
+
+	embed := &discordgo.MessageEmbed{
+		Title:     "User Joined",
+		Color:     0x00FF00,
+		Timestamp: time.Now().Format(time.RFC3339),
+		Thumbnail: &discordgo.MessageEmbedThumbnail{URL: user.AvatarURL("128")},
+		Fields: []*discordgo.MessageEmbedField{
+			{
+				Name:  "User",
+				Value: displayName + " (<@" + user.ID + ">)\n`" + user.Username + "` " + user.ID,
+			},
+		},
+	}
+
+	created, err := discordgo.SnowflakeTimestamp(user.ID)
+	if err == nil {
+		age := time.Since(created)
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+			Name:   "Account Created",
+			Value:  "<t:" + formatUnix(created) + ":D>\n" + formatAge(age),
+			Inline: true,
+		})
+		newAccountDays := viper.GetInt("joinAudit.newAccountDays")
+		if newAccountDays > 0 && age < time.Duration(newAccountDays)*24*time.Hour {
+			embed.Color = auditWarningColor
+			embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+				Name:   "⚠️ New Account",
+				Value:  fmt.Sprintf("Account is less than %d days old", newAccountDays),
+				Inline: true,
+			})
+		}
+	}
+
+	if viper.GetBool("joinAudit.trackInvites") {
+		value := "Unknown"
+		if invite := usedInvite(s, m.GuildID); invite != nil {
+			value = "`" + invite.Code + "`"
+			if invite.Inviter != nil {
+				value += " by <@" + invite.Inviter.ID + ">"
+			}
+			value += fmt.Sprintf(" (%d uses)", invite.Uses)
+		}
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+			Name:   "Invite",
+			Value:  value,
+			Inline: true,
+		})
+	}
+
+	var departure departureRecord
+	found, err := storage.Get(departureBucket, user.ID, &departure)
+	if err != nil {
+		log.Printf("Error reading departure for %s: %v", user.ID, err)
+	}
+	if found {
+		value := fmt.Sprintf("Left <t:%s:R> as `%s`", formatUnix(departure.LeftAt), departure.Username)
+		if departure.Departures > 1 {
+			value += fmt.Sprintf(", %d times in total", departure.Departures)
+		}
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+			Name:  "Previously Left",
+			Value: value,
+		})
+		if len(departure.RestrictedRoles) > 0 {
+			embed.Color = auditAlertColor
+			roles := make([]string, len(departure.RestrictedRoles))
+			for i, role := range departure.RestrictedRoles {
+				roles[i] = "<@&" + role + ">"
+			}
+			embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+				Name:  "⚠️ Left With Restricted Roles",
+				Value: strings.Join(roles, " "),
+			})
+		}
+	}
+
+	return embed
+}
+
+// formatAge describes a duration in the largest whole units, e.g.
+// "2 years, 3 months old"
+func formatAge(age time.Duration) string {
+	days := int(age.Hours() / 24)
+	if days < 1 {
+		return plural(int(age.Hours()), "hour") + " old"
+	}
+	years, months := days/365, (days%365)/30
+	var parts []string
+	if years > 0 {
+		parts = append(parts, plural(years, "year"))
+	}
+	if months > 0 {
+		parts = append(parts, plural(months, "month"))
+	}
+	if len(parts) == 0 {
+		parts = append(parts, plural(days, "day"))
+	}
+	return strings.Join(parts, ", ") + " old"
+}
+
+func plural(n int, unit string) string {
+	if n == 1 {
+		return "1 " + unit
+	}
+	return fmt.Sprintf("%d %ss", n, unit)
+}
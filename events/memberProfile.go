@@ -0,0 +1,207 @@
+package events
+
+import (
+	"log"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// profileChange is one changed member attribute
+type profileChange struct {
+	title    string
+	before   string
+	after    string
+	action   discordgo.AuditLogAction
+	key      discordgo.AuditLogChangeKey
+	selfEdit bool
+	image    string
+	kind     string
+}
+
+// auditMemberProfileChanges posts an audit entry for every nickname,
+// global name, avatar, timeout and membership screening change between
+// the cached member and the update
+func auditMemberProfileChanges(s *discordgo.Session, before, after *discordgo.Member) {
+	var changes []profileChange
+
+	if before.Nick != after.Nick {
+		changes = append(changes, profileChange{
+			title:  "Nickname Changed",
+			before: orNone(before.Nick),
+			after:  orNone(after.Nick),
+			action: discordgo.AuditLogActionMemberUpdate,
+			key:    discordgo.AuditLogChangeKeyNick,
+		})
+	}
+	if before.User.GlobalName != after.User.GlobalName {
+		changes = append(changes, profileChange{
+			title:    "Display Name Changed",
+			before:   orNone(before.User.GlobalName),
+			after:    orNone(after.User.GlobalName),
+			selfEdit: true,
+		})
+	}
+	if before.User.Username != after.User.Username {
+		changes = append(changes, profileChange{
+			title:    "Username Changed",
+			before:   before.User.Username,
+			after:    after.User.Username,
+			selfEdit: true,
+		})
+	}
+	if before.User.Avatar != after.User.Avatar {
+		changes = append(changes, profileChange{
+			title:    "Avatar Changed",
+			before:   avatarLink(before.User.AvatarURL("256"), before.User.Avatar),
+			after:    avatarLink(after.User.AvatarURL("256"), after.User.Avatar),
+			selfEdit: true,
+			image:    after.User.AvatarURL("256"),
+		})
+	}
+	if before.Avatar != after.Avatar {
+		changes = append(changes, profileChange{
+			title:    "Server Avatar Changed",
+			before:   avatarLink(before.AvatarURL("256"), before.Avatar),
+			after:    avatarLink(after.AvatarURL("256"), after.Avatar),
+			selfEdit: true,
+			image:    after.AvatarURL("256"),
+		})
+	}
+	if timeoutUntil(before) != timeoutUntil(after) {
+		title := "Timeout Removed"
+		if timeoutUntil(after) != "" {
+			title = "Member Timed Out"
+		}
+		changes = append(changes, profileChange{
+			title:  title,
+			before: formatTimeout(before),
+			after:  formatTimeout(after),
+			action: discordgo.AuditLogActionMemberUpdate,
+			key:    discordgo.AuditLogChangeKeyCommunicationDisabledUntil,
+			kind:   HistoryTimeout,
+		})
+	}
+	if before.Pending != after.Pending {
+		changes = append(changes, profileChange{
+			title:    "Membership Screening",
+			before:   pendingState(before.Pending),
+			after:    pendingState(after.Pending),
+			selfEdit: true,
+		})
+	}
+	if len(changes) == 0 {
+		return
+	}
+
+	var embeds []*discordgo.MessageEmbed
+	for _, change := range changes {
+		responsible := "<@" + after.User.ID + ">"
+		if !change.selfEdit {
+			responsible = recentAuditLogActor(s, after.GuildID, after.User.ID, change.key, change.action)
+		}
+		embed := &discordgo.MessageEmbed{
+			Title:     change.title,
+			Color:     0x3498DB,
+			Timestamp: time.Now().Format(time.RFC3339),
+			Fields: []*discordgo.MessageEmbedField{
+				{
+					Name:  "User",
+					Value: "<@" + after.User.ID + "> (" + after.User.Username + ")",
+				},
+				{
+					Name:   "Before",
+					Value:  TruncateText(change.before, embedFieldLimit),
+					Inline: true,
+				},
+				{
+					Name:   "After",
+					Value:  TruncateText(change.after, embedFieldLimit),
+					Inline: true,
+				},
+				{
+					Name:  "Changed By",
+					Value: responsible,
+				},
+			},
+		}
+		if change.image != "" {
+			embed.Thumbnail = &discordgo.MessageEmbedThumbnail{URL: change.image}
+		}
+		embeds = append(embeds, embed)
+
+		kind := change.kind
+		if kind == "" {
+			kind = HistoryProfileChange
+		}
+		recordHistory(after.User.ID, kind, responsible, change.title+": "+change.before+" → "+change.after)
+	}
+
+	// A message holds at most 10 embeds
+	for start := 0; start < len(embeds); start += 10 {
+		end := min(start+10, len(embeds))
+		_, err := sendAudit(s, AuditMemberUpdates, "", &discordgo.MessageSend{
+			Embeds: embeds[start:end],
+		})
+		if err != nil {
+			log.Printf("Error sending member update audit log: %v", err)
+		}
+	}
+}
+
+// recentAuditLogActor finds who performed one of the actions on a member,
+// channel or role in the last 30 seconds, preferring the entry sent over
+// the gateway to fetching the audit log. key narrows the match as for
+// recentAuditEntry.
+func recentAuditLogActor(s *discordgo.Session, guildId, targetId string, key discordgo.AuditLogChangeKey, actions ...discordgo.AuditLogAction) string {
+	entry := recentAuditEntry(s, guildId, targetId, key, actions)
+	if entry == nil {
+		return "Unknown"
+	}
+	user, err := s.User(entry.UserID)
+	if err == nil && user.Bot {
+		if invoker := timeoutInvoker(targetId); invoker != "" && *entry.ActionType == discordgo.AuditLogActionMemberUpdate {
+			return "<@" + invoker + "> (via bot)"
+		}
+		return "Bot (via slash command)"
+	}
+	return "<@" + entry.UserID + ">"
+}
+
+func orNone(value string) string {
+	if value == "" {
+		return "*(none)*"
+	}
+	return value
+}
+
+func avatarLink(url, hash string) string {
+	if hash == "" {
+		return "*(default)*"
+	}
+	return "[" + hash + "](" + url + ")"
+}
+
+// timeoutUntil returns when a member's timeout ends, or "" if they are not
+// timed out
+func timeoutUntil(member *discordgo.Member) string {
+	if member.CommunicationDisabledUntil == nil || member.CommunicationDisabledUntil.Before(time.Now()) {
+		return ""
+	}
+	return formatUnix(*member.CommunicationDisabledUntil)
+}
+
+func formatTimeout(member *discordgo.Member) string {
+	until := timeoutUntil(member)
+	if until == "" {
+		return "Not timed out"
+	}
+	return "Until <t:" + until + ":f>"
+}
+
+func pendingState(pending bool) string {
+	if pending {
+		return "Pending rules screening"
+	}
+	return "Passed rules screening"
+}
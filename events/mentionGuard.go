@@ -0,0 +1,184 @@
+package events
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"djs-zth-utilities/storage"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/spf13/viper"
+)
+
+const mentionGuardBucket = "mentionGuard"
+
+// guardedRole is a role under mentionGuard.roles that only some members
+// may ping, or only in some channels
+type guardedRole struct {
+	RoleID            string   `mapstructure:"roleId"`
+	AllowedRoleIDs    []string `mapstructure:"allowedRoleIds"`
+	AllowedChannelIDs []string `mapstructure:"allowedChannelIds"`
+	Guidance          string   `mapstructure:"guidance"`
+}
+
+// allows reports whether a member may ping the role in a channel
+func (g guardedRole) allows(memberRoles []string, channelId string) bool {
+	if contains(g.AllowedChannelIDs, channelId) {
+		return true
+	}
+	for _, role := range g.AllowedRoleIDs {
+		if contains(memberRoles, role) {
+			return true
+		}
+	}
+	return false
+}
+
+// restrictedMentions returns the guarded roles a message pinged without
+// being allowed to
+func restrictedMentions(m *discordgo.MessageCreate, memberRoles []string) []guardedRole {
+	var guarded []guardedRole
+	if err := viper.UnmarshalKey("mentionGuard.roles", &guarded); err != nil {
+		log.Printf("Error reading mentionGuard.roles: %v", err)
+		return nil
+	}
+	var violations []guardedRole
+	for _, role := range guarded {
+		if contains(m.MentionRoles, role.RoleID) && !role.allows(memberRoles, m.ChannelID) {
+			violations = append(violations, role)
+		}
+	}
+	return violations
+}
+
+// guardMentions tells members off for pinging restricted roles, optionally
+// deleting the message, and logs members who keep doing it
+func guardMentions(s *discordgo.Session, m *discordgo.MessageCreate) {
+	if m.GuildID == "" || m.Author == nil || m.Author.Bot || len(m.MentionRoles) == 0 {
+		return
+	}
+	var memberRoles []string
+	if m.Member != nil {
+		memberRoles = m.Member.Roles
+	} else if member, found := memberCache.Get(m.Author.ID); found {
+		memberRoles = member.Roles
+	}
+	violations := restrictedMentions(m, memberRoles)
+	if len(violations) == 0 {
+		return
+	}
+
+	roles := make([]string, len(violations))
+	guidance := []string{}
+	for idx, role := range violations {
+		roles[idx] = "<@&" + role.RoleID + ">"
+		if role.Guidance != "" && !contains(guidance, role.Guidance) {
+			guidance = append(guidance, role.Guidance)
+		}
+	}
+	notice := "You aren't allowed to ping " + strings.Join(roles, ", ") + " here."
+	if len(guidance) > 0 {
+		notice += "\n" + strings.Join(guidance, "\n")
+	}
+
+	deleted := false
+	if viper.GetBool("mentionGuard.deleteMessages") {
+		err := s.ChannelMessageDelete(m.ChannelID, m.ID, discordgo.WithAuditLogReason("Restricted role mention"))
+		if err != nil {
+			log.Printf("Error deleting restricted mention %s: %v", m.ID, err)
+		} else {
+			deleted = true
+		}
+	}
+
+	// A reply can't point at a deleted message, so those are told by DM
+	if deleted || viper.GetString("mentionGuard.notify") == "dm" {
+		if deleted {
+			notice = "Your message in <#" + m.ChannelID + "> was removed. " + notice
+		}
+		if _, err := sendDM(s, m.Author.ID, &discordgo.MessageSend{Content: notice}); err != nil {
+			log.Printf("Error notifying %s of restricted mention: %v", m.Author.ID, err)
+		}
+	} else {
+		_, err := s.ChannelMessageSendComplex(m.ChannelID, &discordgo.MessageSend{
+			Content:   notice,
+			Reference: m.Reference(),
+			// Don't ping the roles again in the notice
+			AllowedMentions: &discordgo.MessageAllowedMentions{RepliedUser: true},
+		})
+		if err != nil {
+			log.Printf("Error replying to restricted mention %s: %v", m.ID, err)
+		}
+	}
+
+	recordMentionOffence(s, m, roles, deleted)
+}
+
+// recordMentionOffence counts a member's restricted mentions within
+// mentionGuard.repeatWindowHours and logs them when they reach
+// mentionGuard.repeatThreshold
+func recordMentionOffence(s *discordgo.Session, m *discordgo.MessageCreate, roles []string, deleted bool) {
+	window := time.Duration(viper.GetInt("mentionGuard.repeatWindowHours")) * time.Hour
+	if window <= 0 {
+		window = 24 * time.Hour
+	}
+	threshold := viper.GetInt("mentionGuard.repeatThreshold")
+	if threshold <= 0 {
+		threshold = 3
+	}
+
+	var offences []time.Time
+	err := storage.Update(mentionGuardBucket, m.Author.ID, &offences, func(found bool) error {
+		kept := offences[:0]
+		for _, offence := range offences {
+			if time.Since(offence) < window {
+				kept = append(kept, offence)
+			}
+		}
+		offences = append(kept, time.Now())
+		return nil
+	})
+	if err != nil {
+		log.Printf("Error recording restricted mention by %s: %v", m.Author.ID, err)
+		return
+	}
+	// Logged once when the threshold is reached rather than for every
+	// mention after it within the window
+	if len(offences) != threshold {
+		return
+	}
+
+	action := "Warned"
+	if deleted {
+		action = "Deleted"
+	}
+	_, err = sendAudit(s, AuditModeration, m.ChannelID, &discordgo.MessageSend{
+		Embeds: []*discordgo.MessageEmbed{
+			{
+				Title:       "Repeated Restricted Role Mentions",
+				Description: fmt.Sprintf("<@%s> (%s) has pinged restricted roles %d times in the last %s", m.Author.ID, m.Author.Username, len(offences), formatDuration(window)),
+				Color:       0xFF9900,
+				Fields: []*discordgo.MessageEmbedField{
+					{
+						Name:  "Latest",
+						Value: strings.Join(roles, ", ") + " in <#" + m.ChannelID + ">",
+					},
+					{
+						Name:   "Action",
+						Value:  action,
+						Inline: true,
+					},
+					{
+						Name:  "Message",
+						Value: orPlaceholder(m.Content),
+					},
+				},
+			},
+		},
+	})
+	if err != nil {
+		log.Printf("Error sending restricted mention to audit log: %v", err)
+	}
+}
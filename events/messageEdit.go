@@ -0,0 +1,211 @@
+package events
+
+import (
+	"log"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/spf13/viper"
+)
+
+const (
+	embedFieldLimit       = 1024
+	embedDescriptionLimit = 4096
+)
+
+func OnMessageUpdate(s *discordgo.Session, m *discordgo.MessageUpdate) {
+	before, _ := messageCache.Get(m.ID)
+
+	// Updates can be partial (e.g. link previews being added), so keep
+	// what we know about the message from the cache
+	after := m.Message
+	if before != nil && after.Author == nil {
+		merged := *before
+		// Embed-only updates such as link unfurls come without content
+		if after.EditedTimestamp != nil || after.Content != "" {
+			merged.Content = after.Content
+			merged.EditedTimestamp = after.EditedTimestamp
+		}
+		if len(after.Embeds) > 0 {
+			merged.Embeds = after.Embeds
+		}
+		after = &merged
+	}
+	messageCache.Add(m.ID, after)
+
+	if before == nil || before.Content == after.Content || after.Author == nil {
+		return
+	}
+	if skipEditAudit(after) {
+		return
+	}
+
+	jumpLink := "https://discord.com/channels/" + m.GuildID + "/" + m.ChannelID + "/" + m.ID
+	embed := &discordgo.MessageEmbed{
+		Title:     "Message Edited",
+		Color:     0x3498DB,
+		Timestamp: time.Now().Format(time.RFC3339),
+		Fields: []*discordgo.MessageEmbedField{
+			{
+				Name:   "Channel",
+				Value:  "<#" + m.ChannelID + ">",
+				Inline: true,
+			},
+			{
+				Name:   "Author",
+				Value:  "<@" + after.Author.ID + ">" + " (" + after.Author.Username + ")",
+				Inline: true,
+			},
+			{
+				Name:  "Message",
+				Value: jumpLink,
+			},
+		},
+	}
+
+	if len(before.Content)+len(after.Content) > embedFieldLimit {
+		// Long messages get a word level diff so the change is easy to spot
+		embed.Description = wordDiff(before.Content, after.Content, embedDescriptionLimit)
+	} else {
+		embed.Fields = append(embed.Fields,
+			&discordgo.MessageEmbedField{
+				Name:  "Before",
+				Value: orPlaceholder(before.Content),
+			},
+			&discordgo.MessageEmbedField{
+				Name:  "After",
+				Value: orPlaceholder(after.Content),
+			},
+		)
+	}
+
+	_, err := sendAudit(s, AuditMessageEdits, m.ChannelID, &discordgo.MessageSend{
+		Embeds: []*discordgo.MessageEmbed{embed},
+	})
+	if err != nil {
+		log.Printf("Error sending message edit audit log: %v", err)
+	}
+}
+
+// skipEditAudit applies messageEditAudit's bot and channel opt-outs
+func skipEditAudit(m *discordgo.Message) bool {
+	if viper.GetBool("messageEditAudit.ignoreBots") && m.Author.Bot {
+		return true
+	}
+	if contains(viper.GetStringSlice("messageEditAudit.ignoredUserIds"), m.Author.ID) {
+		return true
+	}
+	return contains(viper.GetStringSlice("messageEditAudit.ignoredChannelIds"), m.ChannelID)
+}
+
+func orPlaceholder(content string) string {
+	if strings.TrimSpace(content) == "" {
+		return "*(empty)*"
+	}
+	return TruncateText(content, embedFieldLimit)
+}
+
+// TruncateText shortens text to at most limit bytes without splitting a
+// UTF-8 character, marking that it was cut
+func TruncateText(text string, limit int) string {
+	if len(text) <= limit {
+		return text
+	}
+	const marker = "…"
+	cut := limit - len(marker)
+	for cut > 0 && !isRuneStart(text[cut]) {
+		cut--
+	}
+	return text[:cut] + marker
+}
+
+func isRuneStart(b byte) bool {
+	return b&0xC0 != 0x80
+}
+
+// wordDiff renders a word level diff of before and after, with removed
+// words struck through and added words in bold, stopping before limit
+func wordDiff(before, after string, limit int) string {
+	oldWords := strings.Fields(before)
+	newWords := strings.Fields(after)
+
+	// Longest common subsequence table
+	lcs := make([][]int, len(oldWords)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(newWords)+1)
+	}
+	for i := len(oldWords) - 1; i >= 0; i-- {
+		for j := len(newWords) - 1; j >= 0; j-- {
+			if oldWords[i] == newWords[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	type run struct {
+		op    byte // ' ', '-' or '+'
+		words []string
+	}
+	var runs []run
+	push := func(op byte, word string) {
+		if len(runs) > 0 && runs[len(runs)-1].op == op {
+			runs[len(runs)-1].words = append(runs[len(runs)-1].words, word)
+			return
+		}
+		runs = append(runs, run{op: op, words: []string{word}})
+	}
+	i, j := 0, 0
+	for i < len(oldWords) && j < len(newWords) {
+		switch {
+		case oldWords[i] == newWords[j]:
+			push(' ', oldWords[i])
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			push('-', oldWords[i])
+			i++
+		default:
+			push('+', newWords[j])
+			j++
+		}
+	}
+	for ; i < len(oldWords); i++ {
+		push('-', oldWords[i])
+	}
+	for ; j < len(newWords); j++ {
+		push('+', newWords[j])
+	}
+
+	// Render whole runs so truncation never leaves unbalanced markdown
+	const more = " …"
+	var b strings.Builder
+	for _, r := range runs {
+		text := strings.Join(r.words, " ")
+		switch r.op {
+		case '-':
+			text = "~~" + text + "~~"
+		case '+':
+			text = "**" + text + "**"
+		}
+		if b.Len() > 0 {
+			text = " " + text
+		}
+		if b.Len()+len(text)+len(more) > limit {
+			if r.op == ' ' {
+				// Unchanged text has no markdown to unbalance, keep as
+				// much of it as fits
+				b.WriteString(TruncateText(text, limit-b.Len()))
+			} else {
+				b.WriteString(more)
+			}
+			break
+		}
+		b.WriteString(text)
+	}
+	return b.String()
+}
@@ -0,0 +1,249 @@
+package events
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"sync"
+	"time"
+
+	"djs-zth-utilities/storage"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/spf13/viper"
+)
+
+const messageBucket = "messages"
+
+var messageStorePurgeOnce sync.Once
+
+// messageStore keeps messages on disk so deleted and edited messages can
+// be audited after a restart. Message content is encrypted at rest when
+// messageStore.encryptionKey is set.
+type messageStore struct {
+	keyOnce sync.Once
+	aead    cipher.AEAD
+	keyErr  error
+}
+
+// storedMessage is the on-disk form of a cached message. Data holds the
+// message JSON, encrypted if a key is configured.
+type storedMessage struct {
+	ChannelID string    `json:"channel_id"`
+	CreatedAt time.Time `json:"created_at"`
+	Encrypted bool      `json:"encrypted"`
+	Data      []byte    `json:"data"`
+}
+
+// messageKey zero-pads snowflakes so keys sort oldest first
+func messageKey(id string) string {
+	return fmt.Sprintf("%020s", id)
+}
+
+// newMessageCipher builds the cipher for messageStore.encryptionKey, or
+// returns nil if no key is set
+func newMessageCipher() (cipher.AEAD, error) {
+	encoded := viper.GetString("messageStore.encryptionKey")
+	if encoded == "" {
+		log.Println("messageStore.encryptionKey is not set, cached messages are stored unencrypted")
+		return nil, nil
+	}
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding messageStore.encryptionKey: %w", err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid messageStore.encryptionKey: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+// aeadCipher returns the message cipher, or an error if the configured key
+// is invalid so nothing is stored unencrypted by mistake
+func (ms *messageStore) aeadCipher() (cipher.AEAD, error) {
+	ms.keyOnce.Do(func() {
+		ms.aead, ms.keyErr = newMessageCipher()
+	})
+	return ms.aead, ms.keyErr
+}
+
+// ValidateMessageStore checks messageStore.encryptionKey at startup rather
+// than on the first message
+func ValidateMessageStore() error {
+	_, err := messageCache.aeadCipher()
+	return err
+}
+
+// retention returns how long messages from a channel are kept, zero
+// meaning they aren't stored at all
+func (ms *messageStore) retention(channelId string) time.Duration {
+	hours := 168.0
+	if viper.IsSet("messageStore.retentionHours") {
+		hours = viper.GetFloat64("messageStore.retentionHours")
+	}
+	perChannel := viper.GetStringMap("messageStore.channelRetentionHours")
+	if value, ok := perChannel[channelId]; ok {
+		switch v := value.(type) {
+		case int:
+			hours = float64(v)
+		case float64:
+			hours = v
+		}
+	}
+	return time.Duration(hours * float64(time.Hour))
+}
+
+// Add stores or replaces a message
+func (ms *messageStore) Add(id string, m *discordgo.Message) {
+	if ms.retention(m.ChannelID) <= 0 {
+		return
+	}
+	data, err := json.Marshal(m)
+	if err != nil {
+		log.Printf("Error encoding message %s: %v", id, err)
+		return
+	}
+
+	record := storedMessage{
+		ChannelID: m.ChannelID,
+		CreatedAt: m.Timestamp,
+		Data:      data,
+	}
+	if record.CreatedAt.IsZero() {
+		record.CreatedAt = time.Now()
+	}
+	aead, err := ms.aeadCipher()
+	if err != nil {
+		log.Printf("Not storing message %s: %v", id, err)
+		return
+	}
+	if aead != nil {
+		nonce := make([]byte, aead.NonceSize())
+		if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+			log.Printf("Error generating nonce for message %s: %v", id, err)
+			return
+		}
+		record.Data = aead.Seal(nonce, nonce, data, []byte(id))
+		record.Encrypted = true
+	}
+
+	// Every message is written, so concurrent writes share a transaction
+	// and its fsync rather than paying for one each
+	if err := storage.PutBatch(messageBucket, messageKey(id), record); err != nil {
+		log.Printf("Error storing message %s: %v", id, err)
+	}
+}
+
+// Get returns a stored message
+func (ms *messageStore) Get(id string) (*discordgo.Message, bool) {
+	var record storedMessage
+	found, err := storage.Get(messageBucket, messageKey(id), &record)
+	if err != nil {
+		log.Printf("Error reading message %s: %v", id, err)
+		return nil, false
+	}
+	if !found {
+		return nil, false
+	}
+
+	data := record.Data
+	if record.Encrypted {
+		aead, err := ms.aeadCipher()
+		if err != nil || aead == nil {
+			log.Printf("Message %s is encrypted but no key is configured", id)
+			return nil, false
+		}
+		if len(data) < aead.NonceSize() {
+			log.Printf("Stored message %s is corrupt", id)
+			return nil, false
+		}
+		data, err = aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], []byte(id))
+		if err != nil {
+			log.Printf("Error decrypting message %s: %v", id, err)
+			return nil, false
+		}
+	}
+
+	var m discordgo.Message
+	if err := json.Unmarshal(data, &m); err != nil {
+		log.Printf("Error decoding message %s: %v", id, err)
+		return nil, false
+	}
+	return &m, true
+}
+
+// Remove deletes a stored message
+func (ms *messageStore) Remove(id string) {
+	if err := storage.Delete(messageBucket, messageKey(id)); err != nil {
+		log.Printf("Error removing message %s: %v", id, err)
+	}
+}
+
+// purge removes messages past their channel's retention window and then
+// the oldest messages beyond messageStore.maxMessages
+func (ms *messageStore) purge() {
+	expired, err := storage.DeleteWhere(messageBucket, func(key string, value []byte) bool {
+		var record storedMessage
+		if err := json.Unmarshal(value, &record); err != nil {
+			return true
+		}
+		return time.Since(record.CreatedAt) > ms.retention(record.ChannelID)
+	})
+	if err != nil {
+		log.Printf("Error purging expired messages: %v", err)
+		return
+	}
+
+	maxMessages := viper.GetInt("messageStore.maxMessages")
+	overCap := 0
+	if maxMessages > 0 {
+		count := 0
+		err = storage.ForEach(messageBucket, "", func(key string, value []byte) error {
+			count++
+			return nil
+		})
+		if err != nil {
+			log.Printf("Error counting stored messages: %v", err)
+			return
+		}
+		if excess := count - maxMessages; excess > 0 {
+			// Keys sort oldest first
+			seen := 0
+			overCap, err = storage.DeleteWhere(messageBucket, func(key string, value []byte) bool {
+				seen++
+				return seen <= excess
+			})
+			if err != nil {
+				log.Printf("Error trimming stored messages: %v", err)
+			}
+		}
+	}
+
+	if expired > 0 || overCap > 0 {
+		log.Printf("Purged %d expired and %d excess stored messages", expired, overCap)
+	}
+}
+
+// StartMessageStorePurge purges the message store every
+// messageStore.purgeIntervalMinutes
+func StartMessageStorePurge() {
+	messageStorePurgeOnce.Do(func() {
+		minutes := viper.GetInt("messageStore.purgeIntervalMinutes")
+		if minutes <= 0 {
+			minutes = 60
+		}
+		go func() {
+			ticker := time.NewTicker(time.Duration(minutes) * time.Minute)
+			defer ticker.Stop()
+			for ; true; <-ticker.C {
+				messageCache.purge()
+			}
+		}()
+	})
+}
@@ -0,0 +1,437 @@
+package events
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"djs-zth-utilities/storage"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/spf13/viper"
+)
+
+const banRequestBucket = "banRequests"
+
+// ModerationAction is a timeout, kick or ban made through the bot's
+// commands
+type ModerationAction struct {
+	Action      string
+	Target      *discordgo.User
+	ModeratorID string
+	// Moderator is the moderator's member when it is at hand, e.g. from
+	// the interaction, and is fetched otherwise
+	Moderator *discordgo.Member
+	// ApprovedBy is the second moderator who approved a ban
+	ApprovedBy string
+	Reason     string
+	Duration   time.Duration
+	DeleteDays int
+}
+
+// banRequest is a ban waiting for a second moderator
+type banRequest struct {
+	GuildID     string    `json:"guild_id"`
+	TargetID    string    `json:"target_id"`
+	TargetName  string    `json:"target_name"`
+	ModeratorID string    `json:"moderator_id"`
+	Reason      string    `json:"reason"`
+	DeleteDays  int       `json:"delete_days"`
+	CreatedAt   time.Time `json:"created_at"`
+	// Claimed is set while a moderator is acting on the request
+	Claimed bool `json:"claimed,omitempty"`
+}
+
+var (
+	errBanRequestHandled = errors.New("ban request already handled")
+	errBanRequestOwn     = errors.New("ban request made by the approver")
+)
+
+// BanApprovalRequired reports whether bans need a second moderator
+func BanApprovalRequired() bool {
+	return viper.GetBool("moderation.banApproval")
+}
+
+// Moderate carries out a moderation action, logs it to the moderation
+// audit channel and links it to the target's open report cases
+func Moderate(s *discordgo.Session, guildId string, action ModerationAction) error {
+	if err := checkHierarchy(s, guildId, action, action.Target.ID); err != nil {
+		return err
+	}
+	auditReason := discordgo.WithAuditLogReason(TruncateText(action.Reason, 512))
+	var err error
+	var summary string
+	switch action.Action {
+	case "timeout":
+		until := time.Now().Add(action.Duration)
+		TrackTimeoutCommand(action.Target.ID, action.ModeratorID)
+		err = s.GuildMemberTimeout(guildId, action.Target.ID, &until, auditReason)
+		summary = "Timed out for " + formatDuration(action.Duration)
+	case "kick":
+		notice := notifyModerated(s, action, guildId)
+		err = s.GuildMemberDeleteWithReason(guildId, action.Target.ID, action.Reason)
+		summary = "Kicked"
+		if err == nil {
+			recordHistory(action.Target.ID, HistoryKick, "<@"+action.ModeratorID+">", "Kicked: "+action.Reason)
+		} else {
+			retractNotice(s, notice)
+		}
+	case "ban":
+		notice := notifyModerated(s, action, guildId)
+		err = s.GuildBanCreateWithReason(guildId, action.Target.ID, action.Reason, action.DeleteDays)
+		summary = "Banned"
+		if err == nil {
+			recordHistory(action.Target.ID, HistoryBan, "<@"+action.ModeratorID+">", "Banned: "+action.Reason)
+		} else {
+			retractNotice(s, notice)
+		}
+	default:
+		return fmt.Errorf("unknown moderation action %q", action.Action)
+	}
+	if err != nil {
+		return err
+	}
+
+	caseIds := linkOpenCases(s, action.Target.ID, summary, action.ModeratorID)
+
+	embed := &discordgo.MessageEmbed{
+		Title:       "Member " + summary,
+		Description: "<@" + action.Target.ID + "> (" + action.Target.Username + ")",
+		Color:       0xFF0000,
+		Timestamp:   time.Now().Format(time.RFC3339),
+		Fields: []*discordgo.MessageEmbedField{
+			{
+				Name:   "Moderator",
+				Value:  "<@" + action.ModeratorID + ">",
+				Inline: true,
+			},
+			{
+				Name:  "Reason",
+				Value: TruncateText(action.Reason, embedFieldLimit),
+			},
+		},
+	}
+	if action.ApprovedBy != "" {
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+			Name:   "Approved By",
+			Value:  "<@" + action.ApprovedBy + ">",
+			Inline: true,
+		})
+	}
+	if len(caseIds) > 0 {
+		cases := make([]string, len(caseIds))
+		for idx, id := range caseIds {
+			cases[idx] = fmt.Sprintf("#%d", id)
+		}
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+			Name:  "Report Cases",
+			Value: strings.Join(cases, ", "),
+		})
+	}
+	_, err = sendAudit(s, AuditModeration, "", &discordgo.MessageSend{
+		Embeds: []*discordgo.MessageEmbed{embed},
+	})
+	if err != nil {
+		log.Printf("Error sending moderation action to audit log: %v", err)
+	}
+	return nil
+}
+
+// notifyModerated DMs a member before they are kicked or banned, since the
+// bot can't reach them once they have left the server. It returns the DM,
+// or nil if it couldn't be sent.
+func notifyModerated(s *discordgo.Session, action ModerationAction, guildId string) *discordgo.Message {
+	guildName := "the server"
+	if guild, err := s.State.Guild(guildId); err == nil {
+		guildName = guild.Name
+	}
+	verb := "kicked from"
+	if action.Action == "ban" {
+		verb = "banned from"
+	}
+	msg, err := sendDM(s, action.Target.ID, &discordgo.MessageSend{
+		Embeds: []*discordgo.MessageEmbed{
+			{
+				Title:       "You have been " + verb + " " + guildName,
+				Description: TruncateText(action.Reason, 4096),
+				Color:       0xFF0000,
+			},
+		},
+	})
+	if err != nil {
+		log.Printf("Error notifying %s of %s: %v", action.Target.ID, action.Action, err)
+		return nil
+	}
+	return msg
+}
+
+// retractNotice deletes the DM sent by notifyModerated when the kick or
+// ban it announced failed
+func retractNotice(s *discordgo.Session, notice *discordgo.Message) {
+	if notice == nil {
+		return
+	}
+	if err := s.ChannelMessageDelete(notice.ChannelID, notice.ID); err != nil {
+		log.Printf("Error retracting moderation notice %s: %v", notice.ID, err)
+	}
+}
+
+// checkHierarchy refuses to act on members whose highest role is at or
+// above the moderator's, which Discord would only enforce against the bot
+func checkHierarchy(s *discordgo.Session, guildId string, action ModerationAction, targetId string) error {
+	if guild, err := s.State.Guild(guildId); err == nil {
+		switch guild.OwnerID {
+		case action.ModeratorID:
+			return nil
+		case targetId:
+			return errors.New("the server owner can't be moderated")
+		}
+	}
+	moderator := action.Moderator
+	if moderator == nil {
+		var err error
+		moderator, err = GetMember(s, guildId, action.ModeratorID)
+		if err != nil {
+			return err
+		}
+	}
+	target, err := s.GuildMember(guildId, targetId)
+	if err != nil {
+		var restErr *discordgo.RESTError
+		if errors.As(err, &restErr) && restErr.Message != nil && restErr.Message.Code == discordgo.ErrCodeUnknownMember {
+			// Not in the server, e.g. banning someone who already left
+			return nil
+		}
+		return err
+	}
+	if highestRolePosition(s, guildId, target.Roles) >= highestRolePosition(s, guildId, moderator.Roles) {
+		return fmt.Errorf("<@%s> has a role at or above the moderator's highest role", targetId)
+	}
+	return nil
+}
+
+// highestRolePosition returns the position of the highest of the roles,
+// 0 (@everyone) if they have none
+func highestRolePosition(s *discordgo.Session, guildId string, roles []string) int {
+	highest := 0
+	for _, roleId := range roles {
+		if role, err := s.State.Role(guildId, roleId); err == nil && role.Position > highest {
+			highest = role.Position
+		}
+	}
+	return highest
+}
+
+// linkOpenCases records a moderation action on every open report case
+// about the member and returns their numbers
+func linkOpenCases(s *discordgo.Session, userId, summary, moderatorId string) []int {
+	var cases []*ReportCase
+	err := storage.ForEach(reportCaseBucket, "", func(key string, value []byte) error {
+		var reportCase ReportCase
+		if err := json.Unmarshal(value, &reportCase); err != nil {
+			log.Printf("Error decoding report case %s: %v", key, err)
+			return nil
+		}
+		if reportCase.Status == CaseOpen && reportCase.AuthorID == userId {
+			cases = append(cases, &reportCase)
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("Error reading report cases for %s: %v", userId, err)
+	}
+
+	var ids []int
+	for _, reportCase := range cases {
+		err := storage.Update(reportCaseBucket, reportCaseKey(reportCase.ID), reportCase, func(found bool) error {
+			reportCase.Actions = append(reportCase.Actions, caseAction{Action: "Author " + strings.ToLower(summary[:1]) + summary[1:], By: moderatorId, At: time.Now()})
+			return nil
+		})
+		if err != nil {
+			log.Printf("Error updating report case %d: %v", reportCase.ID, err)
+			continue
+		}
+		refreshReportCase(s, reportCase)
+		ids = append(ids, reportCase.ID)
+	}
+	return ids
+}
+
+// RequestBan posts a ban for a second moderator to approve or deny
+func RequestBan(s *discordgo.Session, guildId string, action ModerationAction) error {
+	if err := checkHierarchy(s, guildId, action, action.Target.ID); err != nil {
+		return err
+	}
+	request := banRequest{
+		GuildID:     guildId,
+		TargetID:    action.Target.ID,
+		TargetName:  action.Target.Username,
+		ModeratorID: action.ModeratorID,
+		Reason:      action.Reason,
+		DeleteDays:  action.DeleteDays,
+		CreatedAt:   time.Now(),
+	}
+	id := strconv.FormatInt(request.CreatedAt.UnixNano(), 10)
+	if err := storage.Put(banRequestBucket, id, request); err != nil {
+		return err
+	}
+
+	embed := &discordgo.MessageEmbed{
+		Title:       "Ban Request",
+		Description: "<@" + action.ModeratorID + "> has requested to ban <@" + action.Target.ID + "> (" + action.Target.Username + ")",
+		Color:       0xFF9900,
+		Fields: []*discordgo.MessageEmbedField{
+			{
+				Name:  "Reason",
+				Value: TruncateText(action.Reason, embedFieldLimit),
+			},
+			{
+				Name:   "Delete Messages",
+				Value:  plural(action.DeleteDays, "day"),
+				Inline: true,
+			},
+		},
+	}
+	_, err := sendAudit(s, AuditModeration, "", &discordgo.MessageSend{
+		Content: "||<@&" + viper.GetString("moderatorRoleId") + ">||",
+		Embeds:  []*discordgo.MessageEmbed{embed},
+		Components: []discordgo.MessageComponent{
+			discordgo.ActionsRow{
+				Components: []discordgo.MessageComponent{
+					discordgo.Button{
+						Label:    "Approve",
+						Style:    discordgo.DangerButton,
+						CustomID: "approve_ban_" + id,
+					},
+					discordgo.Button{
+						Label:    "Deny",
+						Style:    discordgo.SecondaryButton,
+						CustomID: "deny_ban_" + id,
+					},
+				},
+			},
+		},
+	})
+	return err
+}
+
+// BanButtonInteractionCreate approves or denies a ban request. The
+// moderator who asked for the ban can't approve it themselves.
+func BanButtonInteractionCreate(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	if i.Type != discordgo.InteractionMessageComponent {
+		return
+	}
+	data := i.MessageComponentData()
+	approve := strings.HasPrefix(data.CustomID, "approve_ban_")
+	deny := strings.HasPrefix(data.CustomID, "deny_ban_")
+	if !approve && !deny {
+		return
+	}
+	id := strings.Split(data.CustomID, "_")[2]
+
+	respond := func(content string) {
+		err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseChannelMessageWithSource,
+			Data: &discordgo.InteractionResponseData{
+				Content: content,
+				Flags:   discordgo.MessageFlagsEphemeral,
+			},
+		})
+		if err != nil {
+			log.Println("Error sending interaction response:", err)
+		}
+	}
+
+	if !HasModeratorRole(i.Member) {
+		respond("You do not have permission to review ban requests.")
+		return
+	}
+	// Claim the request so two moderators pressing at once can't both act
+	// on it
+	var request banRequest
+	err := storage.Update(banRequestBucket, id, &request, func(found bool) error {
+		switch {
+		case !found || request.Claimed:
+			return errBanRequestHandled
+		case approve && request.ModeratorID == i.Member.User.ID:
+			return errBanRequestOwn
+		}
+		request.Claimed = true
+		return nil
+	})
+	switch {
+	case errors.Is(err, errBanRequestHandled):
+		respond("This ban request has already been handled.")
+		return
+	case errors.Is(err, errBanRequestOwn):
+		respond("A different moderator has to approve your ban request.")
+		return
+	case err != nil:
+		log.Printf("Error claiming ban request %s: %v", id, err)
+		respond("Error reading the ban request. Please try again later.")
+		return
+	}
+
+	// Banning fetches both members, DMs the target and logs the ban, which
+	// can outlast the interaction deadline
+	err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseDeferredMessageUpdate,
+	})
+	if err != nil {
+		log.Println("Error sending interaction response:", err)
+	}
+
+	embed := &discordgo.MessageEmbed{
+		Title:       "Ban Request - Denied",
+		Description: "The request to ban <@" + request.TargetID + "> has been denied by <@" + i.Member.User.ID + ">.",
+		Color:       0x808080,
+	}
+	if approve {
+		err = Moderate(s, request.GuildID, ModerationAction{
+			Action:      "ban",
+			Target:      &discordgo.User{ID: request.TargetID, Username: request.TargetName},
+			ModeratorID: request.ModeratorID,
+			ApprovedBy:  i.Member.User.ID,
+			Reason:      request.Reason,
+			DeleteDays:  request.DeleteDays,
+		})
+		if err != nil {
+			log.Printf("Error banning %s: %v", request.TargetID, err)
+			// Release the request so it can be approved again
+			releaseErr := storage.Update(banRequestBucket, id, &request, func(found bool) error {
+				request.Claimed = false
+				return nil
+			})
+			if releaseErr != nil {
+				log.Printf("Error releasing ban request %s: %v", id, releaseErr)
+			}
+			_, err = s.FollowupMessageCreate(i.Interaction, true, &discordgo.WebhookParams{
+				Content: "Failed to ban the member: " + err.Error(),
+				Flags:   discordgo.MessageFlagsEphemeral,
+			})
+			if err != nil {
+				log.Println("Error sending follow-up message:", err)
+			}
+			return
+		}
+		embed.Title = "Ban Request - Approved"
+		embed.Description = "The request to ban <@" + request.TargetID + "> has been approved by <@" + i.Member.User.ID + ">."
+		embed.Color = 0xFF0000
+	}
+	if err := storage.Delete(banRequestBucket, id); err != nil {
+		log.Printf("Error removing ban request %s: %v", id, err)
+	}
+
+	components := []discordgo.MessageComponent{}
+	_, err = s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
+		Embeds:     &[]*discordgo.MessageEmbed{embed},
+		Components: &components,
+	})
+	if err != nil {
+		log.Println("Error editing interaction response:", err)
+	}
+}
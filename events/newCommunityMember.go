@@ -29,29 +29,10 @@ var (
 	}
 )
 
-func WelcomeNewCommunityMember(s *discordgo.Session, m *discordgo.GuildMemberUpdate) {
+func WelcomeNewCommunityMember(s *discordgo.Session, m *discordgo.GuildMemberUpdate, before *discordgo.Member) {
 	r := rand.New(rand.NewSource(time.Now().UnixNano()))
 	greeting := memberGreetings[r.Intn(len(memberGreetings))]
 
-	auditLogs, err := s.GuildAuditLog(m.GuildID, "", "", int(discordgo.AuditLogActionMemberRoleUpdate), 5)
-	if err != nil {
-		log.Println("Error fetching audit logs:", err)
-		return
-	}
-
-	var executorId string
-	for _, entry := range auditLogs.AuditLogEntries {
-		if entry.TargetID == m.User.ID {
-			executorId = entry.UserID
-			break
-		}
-	}
-
-	if executorId == "" {
-		log.Printf("No executor ID found for member %s, assuming self-performed action", m.User.ID)
-		executorId = m.User.ID
-	}
-
 	communityMemberRole := viper.GetString("communityMemberRole")
 	roleAdded := false
 
@@ -62,17 +43,10 @@ func WelcomeNewCommunityMember(s *discordgo.Session, m *discordgo.GuildMemberUpd
 		}
 	}
 
-	// Retrieve the cached member from the memberCache
-	cachedMember, exists := memberCache.Get(m.User.ID)
-	if exists {
-		member, ok := cachedMember.(*discordgo.Member)
-		if !ok {
-			log.Printf("Cached member %s is not of type *discordgo.Member", m.User.ID)
-			return
-		}
-
+	// before is the member as cached ahead of the update
+	if before != nil {
 		// Check if the role already existed in the cached roles
-		for _, role := range member.Roles {
+		for _, role := range before.Roles {
 			if role == communityMemberRole {
 				// Role already existed before the update, no need to send a message
 				roleAdded = false
@@ -85,6 +59,12 @@ func WelcomeNewCommunityMember(s *discordgo.Session, m *discordgo.GuildMemberUpd
 
 	// If the role was newly added, send the welcome message
 	if roleAdded {
+		executorId := RoleChangeAttribution(s, m.GuildID, m.User.ID, []string{communityMemberRole}, nil).UserID()
+		if executorId == "" {
+			log.Printf("No executor ID found for member %s, assuming self-performed action", m.User.ID)
+			executorId = m.User.ID
+		}
+
 		var message string
 		if executorId == m.User.ID {
 			message = "<@" + m.User.ID + "> has joined the community!\nSay " + greeting + " to them!"
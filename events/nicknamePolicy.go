@@ -0,0 +1,266 @@
+package events
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"djs-zth-utilities/storage"
+	"djs-zth-utilities/wow"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/spf13/viper"
+)
+
+const mainCharacterBucket = "mainCharacters"
+
+var nicknameReportOnce sync.Once
+
+// mainCharacterRecord is the main character a member gave in a ticket or
+// through /setnick
+type mainCharacterRecord struct {
+	Name      string    `json:"name"`
+	Source    string    `json:"source"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// RecordMainCharacter stores the main character for a member so their
+// nickname can be checked against it later
+func RecordMainCharacter(userId, mainCharacter, source string) {
+	mainCharacter = wow.NormalizeCharacter(mainCharacter, "").Name
+	if userId == "" || mainCharacter == "" {
+		return
+	}
+	err := storage.Put(mainCharacterBucket, userId, mainCharacterRecord{
+		Name:      mainCharacter,
+		Source:    source,
+		UpdatedAt: time.Now(),
+	})
+	if err != nil {
+		log.Printf("Error storing main character for %s: %v", userId, err)
+	}
+}
+
+// MainCharacter returns the stored main character for a member
+func MainCharacter(userId string) (string, bool) {
+	var record mainCharacterRecord
+	found, err := storage.Get(mainCharacterBucket, userId, &record)
+	if err != nil {
+		log.Printf("Error reading main character for %s: %v", userId, err)
+		return "", false
+	}
+	return record.Name, found
+}
+
+// defaultNicknamePattern requires the nickname to start with the main
+// character's name. Go's \b only knows ASCII letters, so the end of the
+// name is matched explicitly to allow names like Zoë.
+const defaultNicknamePattern = `^{main}(?:$|[^\p{L}\p{N}])`
+
+// nicknamePolicyRegexp compiles nicknamePolicy.pattern for a main
+// character, where {main} in the pattern stands for the character's name
+func nicknamePolicyRegexp(mainCharacter string) (*regexp.Regexp, error) {
+	pattern := viper.GetString("nicknamePolicy.pattern")
+	if pattern == "" {
+		pattern = defaultNicknamePattern
+	}
+	return regexp.Compile("(?i)" + strings.ReplaceAll(pattern, "{main}", regexp.QuoteMeta(mainCharacter)))
+}
+
+// ValidateNicknamePolicy checks that nicknamePolicy.pattern compiles
+func ValidateNicknamePolicy() error {
+	if _, err := nicknamePolicyRegexp("Main"); err != nil {
+		return fmt.Errorf("invalid nicknamePolicy.pattern: %w", err)
+	}
+	return nil
+}
+
+// NicknameMatchesPolicy checks a nickname against nicknamePolicy.pattern.
+// Without a configured pattern the nickname must start with the main
+// character's name.
+func NicknameMatchesPolicy(nickname, mainCharacter string) bool {
+	re, err := nicknamePolicyRegexp(mainCharacter)
+	if err != nil {
+		// Only reachable if the config was reloaded with a bad pattern
+		log.Printf("Invalid nicknamePolicy.pattern, using the default: %v", err)
+		re = regexp.MustCompile("(?i)" + strings.ReplaceAll(defaultNicknamePattern, "{main}", regexp.QuoteMeta(mainCharacter)))
+	}
+	return re.MatchString(strings.TrimSpace(nickname))
+}
+
+// NicknameButtonInteractionCreate handles approver decisions on /setnick
+// requests
+func NicknameButtonInteractionCreate(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	if i.Type != discordgo.InteractionMessageComponent {
+		return
+	}
+	data := i.MessageComponentData()
+	approve := strings.HasPrefix(data.CustomID, "approve_setnick_")
+	deny := strings.HasPrefix(data.CustomID, "deny_setnick_")
+	if !approve && !deny {
+		return
+	}
+	parts := strings.Split(data.CustomID, "_")
+	targetUserID := parts[2]
+
+	member, err := GetMember(s, i.GuildID, i.Member.User.ID)
+	if err != nil {
+		log.Println("Error fetching member:", err)
+		return
+	}
+	if !contains(member.Roles, viper.GetString("roleApproverId")) {
+		err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseChannelMessageWithSource,
+			Data: &discordgo.InteractionResponseData{
+				Content: "You do not have permission to review nickname requests.",
+				Flags:   discordgo.MessageFlagsEphemeral,
+			},
+		})
+		if err != nil {
+			log.Println("Error sending interaction response:", err)
+		}
+		return
+	}
+
+	// The requested nickname is carried in the request embed so pending
+	// requests survive restarts
+	var nickname string
+	if len(i.Message.Embeds) > 0 {
+		for _, field := range i.Message.Embeds[0].Fields {
+			if field.Name == "Main Character" {
+				nickname = field.Value
+			}
+		}
+	}
+	if nickname == "" {
+		log.Printf("Nickname request for %s has no main character field", targetUserID)
+		return
+	}
+
+	var embed *discordgo.MessageEmbed
+	if approve {
+		err = s.GuildMemberNickname(i.GuildID, targetUserID, nickname)
+		if err != nil {
+			log.Println("Error setting nickname:", err)
+			err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+				Type: discordgo.InteractionResponseChannelMessageWithSource,
+				Data: &discordgo.InteractionResponseData{
+					Content: "Failed to set the nickname.",
+					Flags:   discordgo.MessageFlagsEphemeral,
+				},
+			})
+			if err != nil {
+				log.Println("Error sending interaction response:", err)
+			}
+			return
+		}
+		RecordMainCharacter(targetUserID, nickname, "setnick")
+		embed = &discordgo.MessageEmbed{
+			Title:       "Nickname Request - Approved",
+			Description: "<@" + targetUserID + ">'s nickname has been set to `" + nickname + "` by <@" + i.Member.User.ID + ">.",
+			Color:       0x00ff00,
+		}
+	} else {
+		embed = &discordgo.MessageEmbed{
+			Title:       "Nickname Request - Denied",
+			Description: "The request to set <@" + targetUserID + ">'s nickname to `" + nickname + "` has been denied by <@" + i.Member.User.ID + ">.",
+			Color:       0xff0000,
+		}
+	}
+
+	err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseUpdateMessage,
+		Data: &discordgo.InteractionResponseData{
+			Embeds:     []*discordgo.MessageEmbed{embed},
+			Components: []discordgo.MessageComponent{},
+		},
+	})
+	if err != nil {
+		log.Println("Error sending interaction response:", err)
+	}
+}
+
+// StartNicknameReport posts a report of community members with a missing
+// or non-matching nickname every nicknamePolicy.reportIntervalHours
+func StartNicknameReport(s *discordgo.Session) {
+	nicknameReportOnce.Do(func() {
+		hours := viper.GetInt("nicknamePolicy.reportIntervalHours")
+		if hours <= 0 {
+			return
+		}
+		go func() {
+			ticker := time.NewTicker(time.Duration(hours) * time.Hour)
+			defer ticker.Stop()
+			for range ticker.C {
+				postNicknameReport(s)
+			}
+		}()
+	})
+}
+
+func postNicknameReport(s *discordgo.Session) {
+	channelId := viper.GetString("nicknamePolicy.reportChannelId")
+	if channelId == "" {
+		channelId = viper.GetString("accessControlChannelId")
+	}
+	communityMemberRole := viper.GetString("communityMemberRole")
+
+	var missing, mismatched []string
+	for _, member := range memberCache.WithRole(communityMemberRole) {
+		nick := strings.TrimSpace(member.Nick)
+		if nick == "" {
+			missing = append(missing, "<@"+member.User.ID+">")
+			continue
+		}
+		if main, found := MainCharacter(member.User.ID); found && !NicknameMatchesPolicy(nick, main) {
+			mismatched = append(mismatched, fmt.Sprintf("<@%s> `%s` (main: %s)", member.User.ID, nick, main))
+		}
+	}
+	sort.Strings(missing)
+	sort.Strings(mismatched)
+
+	embed := &discordgo.MessageEmbed{
+		Title:     "Nickname Report",
+		Color:     0xFFA500,
+		Timestamp: time.Now().Format(time.RFC3339),
+		Fields: []*discordgo.MessageEmbedField{
+			{
+				Name:  fmt.Sprintf("Missing Nickname (%d)", len(missing)),
+				Value: truncateList(missing, 1024),
+			},
+			{
+				Name:  fmt.Sprintf("Nickname Doesn't Match Main (%d)", len(mismatched)),
+				Value: truncateList(mismatched, 1024),
+			},
+		},
+	}
+	_, err := s.ChannelMessageSendEmbed(channelId, embed)
+	if err != nil {
+		log.Printf("Error sending nickname report: %v", err)
+	}
+}
+
+// truncateList joins items one per line, stopping before limit characters
+// and noting how many were left out
+func truncateList(items []string, limit int) string {
+	if len(items) == 0 {
+		return "None"
+	}
+	var b strings.Builder
+	for idx, item := range items {
+		more := fmt.Sprintf("\n...and %d more", len(items)-idx)
+		if b.Len()+len(item)+1+len(more) > limit {
+			b.WriteString(more)
+			break
+		}
+		if idx > 0 {
+			b.WriteString("\n")
+		}
+		b.WriteString(item)
+	}
+	return b.String()
+}
@@ -0,0 +1,25 @@
+package events
+
+import (
+	"github.com/bwmarrin/discordgo"
+	"github.com/spf13/viper"
+)
+
+// HasModeratorRole reports whether a member holds moderatorRoleId, which
+// moderation commands, report cases and /history are limited to
+func HasModeratorRole(member *discordgo.Member) bool {
+	moderatorRole := viper.GetString("moderatorRoleId")
+	return moderatorRole != "" && contains(member.Roles, moderatorRole)
+}
+
+// HasApproverRole reports whether a member holds one of the
+// rolesRequiringApproval roles, which role management, transcripts, voice
+// stats, attendance and leave checklists are limited to
+func HasApproverRole(member *discordgo.Member) bool {
+	for _, role := range viper.GetStringSlice("rolesRequiringApproval") {
+		if contains(member.Roles, role) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,269 @@
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"djs-zth-utilities/storage"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/spf13/viper"
+)
+
+const raidAttendanceBucket = "raidAttendance"
+
+var raidAttendanceOnce sync.Once
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// RaidTeam is a raid team from the raidTeams config
+type RaidTeam struct {
+	Name           string       `mapstructure:"name"`
+	Value          string       `mapstructure:"value"`
+	VoiceChannelID string       `mapstructure:"voiceChannelId"`
+	RoleID         string       `mapstructure:"roleId"`
+	Schedule       []raidWindow `mapstructure:"schedule"`
+}
+
+// raidWindow is a weekly raid night, e.g. tue and thu at 20:00 for 180
+// minutes in raidAttendance.timezone
+type raidWindow struct {
+	Days            []string `mapstructure:"days"`
+	Start           string   `mapstructure:"start"`
+	DurationMinutes int      `mapstructure:"durationMinutes"`
+}
+
+// RaidAttendance is the attendance record of a single raid
+type RaidAttendance struct {
+	Team      string         `json:"team"`
+	Start     time.Time      `json:"start"`
+	End       time.Time      `json:"end"`
+	Attendees []RaidAttendee `json:"attendees"`
+}
+
+// RaidAttendee is how long a member of the raid role was in the team's
+// voice channel during a raid
+type RaidAttendee struct {
+	UserID  string `json:"user_id"`
+	Minutes int    `json:"minutes"`
+}
+
+// Present reports whether the member was in voice for at least
+// raidAttendance.presentPercent of the raid
+func (r RaidAttendance) Present(attendee RaidAttendee) bool {
+	percent := viper.GetFloat64("raidAttendance.presentPercent")
+	if percent <= 0 {
+		percent = 50
+	}
+	return float64(attendee.Minutes) >= r.End.Sub(r.Start).Minutes()*percent/100
+}
+
+// RaidTeams returns every configured raid team
+func RaidTeams() []RaidTeam {
+	var teams []RaidTeam
+	if err := viper.UnmarshalKey("raidTeams", &teams); err != nil {
+		log.Printf("Error reading raidTeams: %v", err)
+	}
+	return teams
+}
+
+// RaidTeamByValue returns the raid team with the given value
+func RaidTeamByValue(value string) (RaidTeam, bool) {
+	for _, team := range RaidTeams() {
+		if team.Value == value {
+			return team, true
+		}
+	}
+	return RaidTeam{}, false
+}
+
+func raidLocation() *time.Location {
+	name := viper.GetString("raidAttendance.timezone")
+	if name == "" {
+		return time.Local
+	}
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		log.Printf("Invalid raidAttendance.timezone: %v", err)
+		return time.Local
+	}
+	return location
+}
+
+// raidWindowsEndingBetween returns the start and end of every scheduled
+// raid of a team that ends after from and no later than to
+func raidWindowsEndingBetween(team RaidTeam, from, to time.Time) [][2]time.Time {
+	location := raidLocation()
+	var windows [][2]time.Time
+	for _, window := range team.Schedule {
+		clock, err := time.Parse("15:04", window.Start)
+		if err != nil || window.DurationMinutes <= 0 {
+			log.Printf("Invalid schedule for raid team %s: %+v", team.Value, window)
+			continue
+		}
+		duration := time.Duration(window.DurationMinutes) * time.Minute
+		first := from.Add(-duration).In(location)
+		for day := time.Date(first.Year(), first.Month(), first.Day(), 0, 0, 0, 0, location); !day.After(to); day = day.AddDate(0, 0, 1) {
+			for _, name := range window.Days {
+				weekday, ok := weekdays[strings.ToLower(name)[:min(3, len(name))]]
+				if !ok || weekday != day.Weekday() {
+					continue
+				}
+				start := time.Date(day.Year(), day.Month(), day.Day(), clock.Hour(), clock.Minute(), 0, 0, location)
+				end := start.Add(duration)
+				if end.After(from) && !end.After(to) {
+					windows = append(windows, [2]time.Time{start, end})
+				}
+			}
+		}
+	}
+	return windows
+}
+
+func raidAttendanceKey(team string, start time.Time) string {
+	return fmt.Sprintf("%s/%020d", team, start.Unix())
+}
+
+// recordRaidAttendance works out who from the raid role was in the team's
+// voice channel during a raid and for how long
+func recordRaidAttendance(team RaidTeam, start, end time.Time) (RaidAttendance, error) {
+	attendance := RaidAttendance{Team: team.Value, Start: start, End: end}
+	sessions, err := VoiceSessions(team.VoiceChannelID, start)
+	if err != nil {
+		return attendance, err
+	}
+
+	minutes := make(map[string]time.Duration)
+	for _, session := range sessions {
+		sessionEnd := session.End
+		if sessionEnd.IsZero() {
+			sessionEnd = time.Now()
+		}
+		if sessionEnd.After(end) {
+			sessionEnd = end
+		}
+		if overlap := sessionEnd.Sub(session.Start); overlap > 0 {
+			minutes[session.UserID] += overlap
+		}
+	}
+	for _, member := range memberCache.WithRole(team.RoleID) {
+		attendance.Attendees = append(attendance.Attendees, RaidAttendee{
+			UserID:  member.User.ID,
+			Minutes: int(minutes[member.User.ID].Minutes()),
+		})
+	}
+	sort.Slice(attendance.Attendees, func(i, j int) bool {
+		return attendance.Attendees[i].Minutes > attendance.Attendees[j].Minutes
+	})
+
+	err = storage.Put(raidAttendanceBucket, raidAttendanceKey(team.Value, start), attendance)
+	return attendance, err
+}
+
+// RaidAttendanceSince returns a team's recorded raids since a time,
+// oldest first
+func RaidAttendanceSince(team string, since time.Time) ([]RaidAttendance, error) {
+	var raids []RaidAttendance
+	err := storage.ForEach(raidAttendanceBucket, team+"/", func(key string, value []byte) error {
+		var raid RaidAttendance
+		if err := json.Unmarshal(value, &raid); err != nil {
+			log.Printf("Error decoding raid attendance %s: %v", key, err)
+			return nil
+		}
+		if !raid.Start.Before(since) {
+			raids = append(raids, raid)
+		}
+		return nil
+	})
+	return raids, err
+}
+
+// checkRaidWindows records and reports every raid that ended in the last
+// day and hasn't been recorded yet, which also catches raids that ended
+// while the bot was offline
+func checkRaidWindows(s *discordgo.Session) {
+	now := time.Now()
+	for _, team := range RaidTeams() {
+		if team.VoiceChannelID == "" || team.RoleID == "" {
+			continue
+		}
+		for _, window := range raidWindowsEndingBetween(team, now.Add(-24*time.Hour), now) {
+			var existing RaidAttendance
+			found, err := storage.Get(raidAttendanceBucket, raidAttendanceKey(team.Value, window[0]), &existing)
+			if err != nil || found {
+				continue
+			}
+			attendance, err := recordRaidAttendance(team, window[0], window[1])
+			if err != nil {
+				log.Printf("Error recording raid attendance for %s: %v", team.Value, err)
+				continue
+			}
+			postRaidAttendance(s, team, attendance)
+		}
+	}
+}
+
+func postRaidAttendance(s *discordgo.Session, team RaidTeam, attendance RaidAttendance) {
+	channelId := viper.GetString("raidAttendance.reportChannelId")
+	if channelId == "" {
+		return
+	}
+
+	var present, absent []string
+	for _, attendee := range attendance.Attendees {
+		if attendance.Present(attendee) {
+			present = append(present, fmt.Sprintf("<@%s> %s", attendee.UserID, formatDuration(time.Duration(attendee.Minutes)*time.Minute)))
+		} else if attendee.Minutes > 0 {
+			absent = append(absent, fmt.Sprintf("<@%s> %s (partial)", attendee.UserID, formatDuration(time.Duration(attendee.Minutes)*time.Minute)))
+		} else {
+			absent = append(absent, "<@"+attendee.UserID+">")
+		}
+	}
+
+	embed := &discordgo.MessageEmbed{
+		Title:       "Raid Attendance - " + team.Name,
+		Description: fmt.Sprintf("<t:%d:f> - <t:%d:t> in <#%s>", attendance.Start.Unix(), attendance.End.Unix(), team.VoiceChannelID),
+		Color:       0x9B59B6,
+		Fields: []*discordgo.MessageEmbedField{
+			{
+				Name:  fmt.Sprintf("Present (%d)", len(present)),
+				Value: truncateList(present, embedFieldLimit),
+			},
+			{
+				Name:  fmt.Sprintf("Absent (%d)", len(absent)),
+				Value: truncateList(absent, embedFieldLimit),
+			},
+		},
+	}
+	_, err := s.ChannelMessageSendEmbed(channelId, embed)
+	if err != nil {
+		log.Printf("Error sending raid attendance report: %v", err)
+	}
+}
+
+// StartRaidAttendance checks every minute for raids that have ended
+func StartRaidAttendance(s *discordgo.Session) {
+	raidAttendanceOnce.Do(func() {
+		go func() {
+			ticker := time.NewTicker(time.Minute)
+			defer ticker.Stop()
+			// The first check waits a minute for the member cache to fill
+			for range ticker.C {
+				checkRaidWindows(s)
+			}
+		}()
+	})
+}
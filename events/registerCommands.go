@@ -32,6 +32,9 @@ func buildRaidTeamChoices() []*discordgo.ApplicationCommandOptionChoice {
 }
 
 func RegisterCommands(s *discordgo.Session) {
+	minDays := 1.0
+	minMinutes := 1.0
+	minDeleteDays := 0.0
 	teamChoices := buildRaidTeamChoices()
 	gameChoices := []*discordgo.ApplicationCommandOptionChoice{
 		{Name: "World of Warcraft", Value: "wow"},
@@ -90,6 +93,215 @@ func RegisterCommands(s *discordgo.Session) {
 				},
 			},
 		},
+		{
+			Name:        "setnick",
+			Description: "Request your server nickname be set to your main character",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "main",
+					Description: "Your main character's name",
+					Required:    true,
+				},
+			},
+		},
+		{
+			Name:        "transcript",
+			Description: "Generate a transcript of a ticket thread",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionChannel,
+					Name:        "thread",
+					Description: "The ticket thread to generate a transcript for",
+					Required:    true,
+					ChannelTypes: []discordgo.ChannelType{
+						discordgo.ChannelTypeGuildPublicThread,
+						discordgo.ChannelTypeGuildPrivateThread,
+					},
+				},
+			},
+		},
+		{
+			Name:        "history",
+			Description: "Show a member's moderation history",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionUser,
+					Name:        "user",
+					Description: "The member to show the history of",
+					Required:    true,
+				},
+			},
+		},
+		{
+			Name:        "voicestats",
+			Description: "Show time spent in voice channels",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:         discordgo.ApplicationCommandOptionChannel,
+					Name:         "channel",
+					Description:  "Only count time in this voice channel",
+					ChannelTypes: []discordgo.ChannelType{discordgo.ChannelTypeGuildVoice, discordgo.ChannelTypeGuildStageVoice},
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionRole,
+					Name:        "role",
+					Description: "Only count members with this role, e.g. a raid team",
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionInteger,
+					Name:        "days",
+					Description: "How many days back to count (default 30)",
+					MinValue:    &minDays,
+					MaxValue:    365,
+				},
+			},
+		},
+		{
+			Name:        "attendance",
+			Description: "Show a raid team's attendance from voice presence",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "team",
+					Description: "The raid team",
+					Required:    true,
+					Choices:     teamChoices,
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionInteger,
+					Name:        "range",
+					Description: "How many days back to include (default 30)",
+					MinValue:    &minDays,
+					MaxValue:    365,
+				},
+			},
+		},
+		{
+			Name:        "warn",
+			Description: "Warn a member and record it as an infraction",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionUser,
+					Name:        "user",
+					Description: "The member to warn",
+					Required:    true,
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "reason",
+					Description: "Why the member is being warned, sent to them in a DM",
+					Required:    true,
+					MaxLength:   500,
+				},
+			},
+		},
+		{
+			Name:        "infractions",
+			Description: "Show a member's warnings",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionUser,
+					Name:        "user",
+					Description: "The member to show the warnings of",
+					Required:    true,
+				},
+			},
+		},
+		{
+			Name:        "pardon",
+			Description: "Pardon a member's warning so it no longer counts",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionUser,
+					Name:        "user",
+					Description: "The member to pardon",
+					Required:    true,
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionInteger,
+					Name:        "warning",
+					Description: "The warning number (defaults to their most recent active warning)",
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "reason",
+					Description: "Why the warning is being pardoned",
+				},
+			},
+		},
+		{
+			Name:        "timeout",
+			Description: "Time out a member",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionUser,
+					Name:        "user",
+					Description: "The member to time out",
+					Required:    true,
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "reason",
+					Description: "Why the member is being timed out",
+					Required:    true,
+					MaxLength:   500,
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionInteger,
+					Name:        "minutes",
+					Description: "How long to time the member out for",
+					Required:    true,
+					MinValue:    &minMinutes,
+					MaxValue:    40320,
+				},
+			},
+		},
+		{
+			Name:        "kick",
+			Description: "Kick a member from the server",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionUser,
+					Name:        "user",
+					Description: "The member to kick",
+					Required:    true,
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "reason",
+					Description: "Why the member is being kicked",
+					Required:    true,
+					MaxLength:   500,
+				},
+			},
+		},
+		{
+			Name:        "ban",
+			Description: "Ban a member from the server",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionUser,
+					Name:        "user",
+					Description: "The member to ban",
+					Required:    true,
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "reason",
+					Description: "Why the member is being banned",
+					Required:    true,
+					MaxLength:   500,
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionInteger,
+					Name:        "delete-days",
+					Description: "Delete the member's messages from the last days (default 0)",
+					MinValue:    &minDeleteDays,
+					MaxValue:    7,
+				},
+			},
+		},
 		{
 			Name: "Report Message",
 			Type: discordgo.MessageApplicationCommand,
@@ -0,0 +1,262 @@
+package events
+
+import (
+	"log"
+	"strings"
+
+	"djs-zth-utilities/storage"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/spf13/viper"
+)
+
+// SendRoleApprovalRequest posts a role request to accessControlChannelId
+// for an approver to approve or deny
+func SendRoleApprovalRequest(s *discordgo.Session, requesterId string, target *discordgo.User, roleId string) error {
+	approvalRole := viper.GetString("roleApproverId")
+	targetUsername := target.Username
+	if target.GlobalName != "" {
+		targetUsername = target.GlobalName
+	}
+
+	embed := &discordgo.MessageEmbed{
+		Title:       "Role Request",
+		Description: "<@" + requesterId + "> has requested to add the <@&" + roleId + "> role to " + "<@" + target.ID + ">" + " (" + targetUsername + ")",
+
+		Color: 0x00ff00,
+		Fields: []*discordgo.MessageEmbedField{
+			{
+				Name:   "Approval Role",
+				Value:  "<@&" + approvalRole + ">",
+				Inline: true,
+			},
+		},
+	}
+	_, err := s.ChannelMessageSendComplex(viper.GetString("accessControlChannelId"), &discordgo.MessageSend{
+		Content: "||<@&" + approvalRole + ">||",
+		Embeds:  []*discordgo.MessageEmbed{embed},
+		Components: []discordgo.MessageComponent{
+			discordgo.ActionsRow{
+				Components: []discordgo.MessageComponent{
+					discordgo.Button{
+						Label:    "Approve",
+						Style:    discordgo.PrimaryButton,
+						CustomID: "approve_add_role_" + target.ID + "_" + roleId,
+					},
+					discordgo.Button{
+						Label:    "Deny",
+						Style:    discordgo.DangerButton,
+						CustomID: "deny_add_role_" + target.ID + "_" + roleId,
+					},
+				},
+			},
+		},
+	})
+	return err
+}
+
+// restorableRoles returns the roles a member had when they left that can
+// still be given back, leaving out @everyone, deleted roles and roles
+// managed by integrations
+func restorableRoles(guildId string, roles []string) []string {
+	roleSnapshotsMu.Lock()
+	defer roleSnapshotsMu.Unlock()
+	var restorable []string
+	for _, roleId := range roles {
+		role, exists := roleSnapshots[roleId]
+		if roleId == guildId || !exists || role.Managed {
+			continue
+		}
+		restorable = append(restorable, roleId)
+	}
+	return restorable
+}
+
+// postRejoinNotice tells approvers a former member is back and what roles
+// they had, with a button to give them back
+func postRejoinNotice(s *discordgo.Session, m *discordgo.GuildMemberAdd) {
+	var departure departureRecord
+	found, err := storage.Get(departureBucket, m.User.ID, &departure)
+	if err != nil || !found {
+		return
+	}
+	roles := restorableRoles(m.GuildID, departure.Roles)
+	if len(roles) == 0 {
+		return
+	}
+	mentions := make([]string, len(roles))
+	for idx, role := range roles {
+		mentions[idx] = "<@&" + role + ">"
+		if contains(departure.RestrictedRoles, role) {
+			mentions[idx] += " (needs approval)"
+		}
+	}
+
+	embed := &discordgo.MessageEmbed{
+		Title:       "Member Rejoined",
+		Description: "<@" + m.User.ID + "> (" + m.User.Username + ") has rejoined the server. They left <t:" + formatUnix(departure.LeftAt) + ":R>.",
+		Color:       0x3498DB,
+		Fields: []*discordgo.MessageEmbedField{
+			{
+				Name:  "Previous Roles",
+				Value: truncateList(mentions, embedFieldLimit),
+			},
+		},
+	}
+	_, err = s.ChannelMessageSendComplex(viper.GetString("accessControlChannelId"), &discordgo.MessageSend{
+		Embeds: []*discordgo.MessageEmbed{embed},
+		Components: []discordgo.MessageComponent{
+			discordgo.ActionsRow{
+				Components: []discordgo.MessageComponent{
+					discordgo.Button{
+						Label:    "Restore Roles",
+						Style:    discordgo.PrimaryButton,
+						CustomID: "restore_roles_" + m.User.ID,
+					},
+					discordgo.Button{
+						Label:    "Dismiss",
+						Style:    discordgo.SecondaryButton,
+						CustomID: "dismiss_roles_" + m.User.ID,
+					},
+				},
+			},
+		},
+	})
+	if err != nil {
+		log.Printf("Error sending rejoin notice: %v", err)
+	}
+}
+
+// RestoreRolesInteractionCreate gives a rejoined member their previous
+// roles back. Roles requiring approval are sent through the usual role
+// request instead of being added directly.
+func RestoreRolesInteractionCreate(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	if i.Type != discordgo.InteractionMessageComponent {
+		return
+	}
+	data := i.MessageComponentData()
+	restore := strings.HasPrefix(data.CustomID, "restore_roles_")
+	dismiss := strings.HasPrefix(data.CustomID, "dismiss_roles_")
+	if !restore && !dismiss {
+		return
+	}
+	targetUserID := strings.Split(data.CustomID, "_")[2]
+
+	if !contains(i.Member.Roles, viper.GetString("roleApproverId")) {
+		err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseChannelMessageWithSource,
+			Data: &discordgo.InteractionResponseData{
+				Content: "You do not have permission to restore roles.",
+				Flags:   discordgo.MessageFlagsEphemeral,
+			},
+		})
+		if err != nil {
+			log.Println("Error sending interaction response:", err)
+		}
+		return
+	}
+
+	// Restoring makes a request per role, which can outlast the interaction
+	// deadline, so the message is edited once it's done
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseDeferredMessageUpdate,
+	})
+	if err != nil {
+		log.Println("Error sending interaction response:", err)
+		return
+	}
+
+	var embed *discordgo.MessageEmbed
+	if len(i.Message.Embeds) > 0 {
+		embed = i.Message.Embeds[0]
+	} else {
+		embed = &discordgo.MessageEmbed{Title: "Member Rejoined"}
+	}
+
+	if dismiss {
+		embed.Color = 0x808080
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+			Name:  "Dismissed",
+			Value: "Roles were not restored, dismissed by <@" + i.Member.User.ID + ">",
+		})
+	} else {
+		var departure departureRecord
+		found, err := storage.Get(departureBucket, targetUserID, &departure)
+		if err != nil || !found {
+			log.Printf("No departure record to restore roles for %s: %v", targetUserID, err)
+			restoreRolesFollowup(s, i, "The roles <@"+targetUserID+"> left with are no longer recorded.")
+			return
+		}
+		// Fetched rather than cached so roles given since they rejoined count
+		target, err := s.GuildMember(i.GuildID, targetUserID)
+		if err != nil {
+			log.Printf("Error fetching member %s: %v", targetUserID, err)
+			restoreRolesFollowup(s, i, "Couldn't fetch <@"+targetUserID+">, they may have left again.")
+			return
+		}
+
+		var restored, requested, failed []string
+		for _, roleId := range restorableRoles(i.GuildID, departure.Roles) {
+			if contains(target.Roles, roleId) {
+				continue
+			}
+			if contains(viper.GetStringSlice("rolesRequiringApproval"), roleId) {
+				if err := SendRoleApprovalRequest(s, i.Member.User.ID, target.User, roleId); err != nil {
+					log.Printf("Error sending role request for %s: %v", targetUserID, err)
+					failed = append(failed, "<@&"+roleId+">")
+					continue
+				}
+				requested = append(requested, "<@&"+roleId+">")
+				continue
+			}
+			TrackRoleCommand(targetUserID, i.Member.User.ID, roleId)
+			if err := s.GuildMemberRoleAdd(i.GuildID, targetUserID, roleId); err != nil {
+				log.Printf("Error restoring role %s to %s: %v", roleId, targetUserID, err)
+				failed = append(failed, "<@&"+roleId+">")
+				continue
+			}
+			restored = append(restored, "<@&"+roleId+">")
+		}
+
+		embed.Color = 0x00ff00
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+			Name:  "Restored By",
+			Value: "<@" + i.Member.User.ID + ">",
+		})
+		for _, result := range []struct {
+			name  string
+			roles []string
+		}{
+			{"Roles Restored", restored},
+			{"Sent for Approval", requested},
+			{"Failed", failed},
+		} {
+			if len(result.roles) > 0 {
+				embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+					Name:  result.name,
+					Value: truncateList(result.roles, embedFieldLimit),
+				})
+			}
+		}
+	}
+
+	components := []discordgo.MessageComponent{}
+	_, err = s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
+		Embeds:     &[]*discordgo.MessageEmbed{embed},
+		Components: &components,
+	})
+	if err != nil {
+		log.Println("Error editing interaction response:", err)
+	}
+}
+
+// restoreRolesFollowup tells the approver why roles couldn't be restored
+func restoreRolesFollowup(s *discordgo.Session, i *discordgo.InteractionCreate, content string) {
+	_, err := s.FollowupMessageCreate(i.Interaction, true, &discordgo.WebhookParams{
+		Content: content,
+		Flags:   discordgo.MessageFlagsEphemeral,
+	})
+	if err != nil {
+		log.Println("Error sending follow-up message:", err)
+	}
+}
@@ -0,0 +1,591 @@
+package events
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"djs-zth-utilities/storage"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/spf13/viper"
+)
+
+const (
+	reportCaseBucket    = "reportCases"
+	reportCounterBucket = "reportCaseCounter"
+	// reportCaseIndexBucket maps a reported message to its open case
+	reportCaseIndexBucket = "reportCaseByMessage"
+)
+
+// reportLocks serializes finding or opening the case for a reported
+// message, per message
+var reportLocks = idLocks{locks: make(map[string]*idLock)}
+
+var (
+	errReportCaseClosed  = errors.New("report case already closed")
+	errReportCaseClaimed = errors.New("report case claimed by another moderator")
+)
+
+// Report case statuses
+const (
+	CaseOpen      = "open"
+	CaseResolved  = "resolved"
+	CaseDismissed = "dismissed"
+)
+
+// ReportCase is a reported message, snapshotted when it was reported so it
+// survives the message being edited or deleted
+type ReportCase struct {
+	ID             int          `json:"id"`
+	Status         string       `json:"status"`
+	GuildID        string       `json:"guild_id"`
+	ChannelID      string       `json:"channel_id"`
+	MessageID      string       `json:"message_id"`
+	AuthorID       string       `json:"author_id"`
+	AuthorName     string       `json:"author_name"`
+	Content        string       `json:"content"`
+	Attachments    []string     `json:"attachments,omitempty"`
+	Reports        []caseReport `json:"reports"`
+	Actions        []caseAction `json:"actions,omitempty"`
+	AuditChannelID string       `json:"audit_channel_id,omitempty"`
+	AuditMessageID string       `json:"audit_message_id,omitempty"`
+	CreatedAt      time.Time    `json:"created_at"`
+	// Claimed is set while a moderator is acting on the case
+	Claimed bool `json:"claimed,omitempty"`
+}
+
+type caseReport struct {
+	UserID string    `json:"user_id"`
+	Reason string    `json:"reason"`
+	At     time.Time `json:"at"`
+}
+
+// caseAction is something a moderator did from the case embed
+type caseAction struct {
+	Action string    `json:"action"`
+	By     string    `json:"by"`
+	At     time.Time `json:"at"`
+}
+
+func reportCaseKey(id int) string {
+	return fmt.Sprintf("%010d", id)
+}
+
+// messageLink links to the reported message
+func (c *ReportCase) messageLink() string {
+	return "https://discord.com/channels/" + c.GuildID + "/" + c.ChannelID + "/" + c.MessageID
+}
+
+// nextReportCaseID hands out case numbers starting at 1
+func nextReportCaseID() (int, error) {
+	var next int
+	err := storage.Update(reportCounterBucket, "next", &next, func(found bool) error {
+		next++
+		return nil
+	})
+	return next, err
+}
+
+// GetReportCase loads a case by its number
+func GetReportCase(id int) (*ReportCase, bool) {
+	var reportCase ReportCase
+	found, err := storage.Get(reportCaseBucket, reportCaseKey(id), &reportCase)
+	if err != nil {
+		log.Printf("Error reading report case %d: %v", id, err)
+	}
+	return &reportCase, found
+}
+
+// openReportCase snapshots a reported message into a new case
+func openReportCase(guildId string, msg *discordgo.Message, reporterId, reason string) (*ReportCase, error) {
+	id, err := nextReportCaseID()
+	if err != nil {
+		return nil, err
+	}
+	reportCase := &ReportCase{
+		ID:        id,
+		Status:    CaseOpen,
+		GuildID:   guildId,
+		ChannelID: msg.ChannelID,
+		MessageID: msg.ID,
+		Content:   msg.Content,
+		Reports:   []caseReport{{UserID: reporterId, Reason: reason, At: time.Now()}},
+		CreatedAt: time.Now(),
+	}
+	if msg.Author != nil {
+		reportCase.AuthorID = msg.Author.ID
+		reportCase.AuthorName = msg.Author.Username
+	}
+	for _, attachment := range msg.Attachments {
+		reportCase.Attachments = append(reportCase.Attachments, attachment.URL)
+	}
+	if err := storage.Put(reportCaseBucket, reportCaseKey(id), reportCase); err != nil {
+		return nil, err
+	}
+	return reportCase, storage.Put(reportCaseIndexBucket, msg.ID, id)
+}
+
+// openCaseForMessage returns the open case for a reported message, if any
+func openCaseForMessage(messageId string) (*ReportCase, bool) {
+	var id int
+	found, err := storage.Get(reportCaseIndexBucket, messageId, &id)
+	if err != nil || !found {
+		return nil, false
+	}
+	reportCase, found := GetReportCase(id)
+	if !found || reportCase.Status != CaseOpen {
+		return nil, false
+	}
+	return reportCase, true
+}
+
+// addReport adds another member's report to an open case. added is false
+// if they had already reported the message.
+func addReport(id int, reporterId, reason string) (reportCase *ReportCase, added bool, err error) {
+	reportCase = &ReportCase{}
+	err = storage.Update(reportCaseBucket, reportCaseKey(id), reportCase, func(found bool) error {
+		if !found {
+			return fmt.Errorf("report case %d not found", id)
+		}
+		for _, report := range reportCase.Reports {
+			if report.UserID == reporterId {
+				return nil
+			}
+		}
+		reportCase.Reports = append(reportCase.Reports, caseReport{UserID: reporterId, Reason: reason, At: time.Now()})
+		added = true
+		return nil
+	})
+	return reportCase, added, err
+}
+
+// reportPingThresholds are the numbers of reporters at which moderators are
+// pinged about a case
+func reportPingThresholds() []int {
+	if !viper.IsSet("reports.pingThresholds") {
+		return []int{1, 3, 5}
+	}
+	return viper.GetIntSlice("reports.pingThresholds")
+}
+
+// reportPingContent pings moderators if a case just reached a threshold
+func reportPingContent(reportCase *ReportCase) string {
+	count := len(reportCase.Reports)
+	for _, threshold := range reportPingThresholds() {
+		if threshold != count {
+			continue
+		}
+		if count == 1 {
+			return "<@&" + viper.GetString("moderatorRoleId") + ">"
+		}
+		return fmt.Sprintf("<@&%s> Report case #%d has now been reported by %d members", viper.GetString("moderatorRoleId"), reportCase.ID, count)
+	}
+	return ""
+}
+
+// notifyReporters lets everyone who reported a message know their case was
+// closed, unless reports.notifyReporters is false
+func notifyReporters(s *discordgo.Session, reportCase *ReportCase) {
+	if viper.IsSet("reports.notifyReporters") && !viper.GetBool("reports.notifyReporters") {
+		return
+	}
+	outcome := "reviewed and action has been taken"
+	if reportCase.Status == CaseDismissed {
+		outcome = "reviewed and no action was needed"
+	}
+	for _, report := range reportCase.Reports {
+		_, err := sendDM(s, report.UserID, &discordgo.MessageSend{
+			Embeds: []*discordgo.MessageEmbed{
+				{
+					Title:       fmt.Sprintf("Report Case #%d", reportCase.ID),
+					Description: fmt.Sprintf("Thank you for your report of a message in <#%s>. Moderators have %s.", reportCase.ChannelID, outcome),
+					Color:       caseStatusColors[reportCase.Status],
+				},
+			},
+		})
+		if err != nil {
+			log.Printf("Error notifying reporter %s of case %d: %v", report.UserID, reportCase.ID, err)
+		}
+	}
+}
+
+// caseStatusColors colours the case embed by status
+var caseStatusColors = map[string]int{
+	CaseOpen:      0xFF9900,
+	CaseResolved:  0x00ff00,
+	CaseDismissed: 0x808080,
+}
+
+// embed renders the case for moderators
+func (c *ReportCase) embed() *discordgo.MessageEmbed {
+	content := c.Content
+	if len(c.Attachments) > 0 {
+		content += "\n" + strings.Join(c.Attachments, "\n")
+	}
+
+	reports := make([]string, len(c.Reports))
+	for idx, report := range c.Reports {
+		reports[idx] = fmt.Sprintf("<@%s> <t:%d:R>: %s", report.UserID, report.At.Unix(), orNone(report.Reason))
+	}
+
+	embed := &discordgo.MessageEmbed{
+		Title:       fmt.Sprintf("Report Case #%d", c.ID),
+		Description: "Message " + c.messageLink() + " in <#" + c.ChannelID + "> has been reported.",
+		Color:       caseStatusColors[c.Status],
+		Fields: []*discordgo.MessageEmbedField{
+			{
+				Name:   "Author",
+				Value:  "<@" + c.AuthorID + "> (" + c.AuthorName + ")",
+				Inline: true,
+			},
+			{
+				Name:   "Status",
+				Value:  strings.ToUpper(c.Status[:1]) + c.Status[1:],
+				Inline: true,
+			},
+			{
+				Name:  "Content",
+				Value: orPlaceholder(content),
+			},
+			{
+				Name:  fmt.Sprintf("Reports (%d)", len(c.Reports)),
+				Value: truncateList(reports, embedFieldLimit),
+			},
+		},
+		Timestamp: c.CreatedAt.Format(time.RFC3339),
+	}
+	if len(c.Actions) > 0 {
+		actions := make([]string, len(c.Actions))
+		for idx, action := range c.Actions {
+			actions[idx] = fmt.Sprintf("%s by <@%s> <t:%d:R>", action.Action, action.By, action.At.Unix())
+		}
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+			Name:  "Actions",
+			Value: truncateList(actions, embedFieldLimit),
+		})
+	}
+	return embed
+}
+
+// components renders the moderator buttons, removed once the case is closed
+func (c *ReportCase) components() []discordgo.MessageComponent {
+	if c.Status != CaseOpen {
+		return []discordgo.MessageComponent{}
+	}
+	id := strconv.Itoa(c.ID)
+	return []discordgo.MessageComponent{
+		discordgo.ActionsRow{
+			Components: []discordgo.MessageComponent{
+				discordgo.Button{
+					Label:    "Delete Message",
+					Style:    discordgo.DangerButton,
+					CustomID: "reportcase_delete_" + id,
+				},
+				discordgo.Button{
+					Label:    "Timeout Author",
+					Style:    discordgo.DangerButton,
+					CustomID: "reportcase_timeout_" + id,
+				},
+				discordgo.Button{
+					Label:    "Warn Author",
+					Style:    discordgo.PrimaryButton,
+					CustomID: "reportcase_warn_" + id,
+				},
+				discordgo.Button{
+					Label:    "Resolve",
+					Style:    discordgo.SuccessButton,
+					CustomID: "reportcase_resolve_" + id,
+				},
+				discordgo.Button{
+					Label:    "Dismiss",
+					Style:    discordgo.SecondaryButton,
+					CustomID: "reportcase_dismiss_" + id,
+				},
+			},
+		},
+	}
+}
+
+// sendDM sends a direct message to a user, which fails if they have DMs
+// from server members turned off
+func sendDM(s *discordgo.Session, userId string, msg *discordgo.MessageSend) (*discordgo.Message, error) {
+	channel, err := s.UserChannelCreate(userId)
+	if err != nil {
+		return nil, err
+	}
+	return s.ChannelMessageSendComplex(channel.ID, msg)
+}
+
+// reportTimeout is how long the Timeout Author button times members out for
+func reportTimeout() time.Duration {
+	minutes := viper.GetInt("reports.timeoutMinutes")
+	if minutes <= 0 {
+		minutes = 60
+	}
+	return time.Duration(minutes) * time.Minute
+}
+
+// applyCaseAction carries out a moderator button and returns how it should
+// be recorded on the case, or "" if it already was
+func applyCaseAction(s *discordgo.Session, reportCase *ReportCase, action string, moderator *discordgo.Member, warnReason string) (string, error) {
+	author := &discordgo.User{ID: reportCase.AuthorID, Username: reportCase.AuthorName}
+	switch action {
+	case "delete":
+		reason := discordgo.WithAuditLogReason(fmt.Sprintf("Report case #%d by %s", reportCase.ID, moderator.User.ID))
+		err := s.ChannelMessageDelete(reportCase.ChannelID, reportCase.MessageID, reason)
+		return "Message deleted", err
+	case "timeout":
+		// Moderate records the timeout on the author's open cases,
+		// including this one
+		err := Moderate(s, reportCase.GuildID, ModerationAction{
+			Action:      "timeout",
+			Target:      author,
+			ModeratorID: moderator.User.ID,
+			Moderator:   moderator,
+			Reason:      fmt.Sprintf("Report case #%d", reportCase.ID),
+			Duration:    reportTimeout(),
+		})
+		return "", err
+	case "warn":
+		inf, err := Warn(s, reportCase.GuildID, author, moderator.User.ID, warnReason, reportCase.ID)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("Author warned (#%d)", inf.ID), nil
+	case "resolve":
+		reportCase.Status = CaseResolved
+		return "Resolved", nil
+	case "dismiss":
+		reportCase.Status = CaseDismissed
+		return "Dismissed", nil
+	}
+	return "", fmt.Errorf("unknown report case action %q", action)
+}
+
+// ReportCaseInteractionCreate handles the moderator buttons on a report case
+func ReportCaseInteractionCreate(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	if i.Type != discordgo.InteractionMessageComponent {
+		return
+	}
+	customID := i.MessageComponentData().CustomID
+	if !strings.HasPrefix(customID, "reportcase_") {
+		return
+	}
+	parts := strings.Split(customID, "_")
+	if len(parts) != 3 {
+		return
+	}
+	id, err := strconv.Atoi(parts[2])
+	if err != nil {
+		return
+	}
+
+	reportCase, ok := openCaseForModerator(s, i, id)
+	if !ok {
+		return
+	}
+	if parts[1] == "warn" {
+		showWarnReasonModal(s, i, reportCase)
+		return
+	}
+	actOnReportCase(s, i, reportCase, parts[1], "")
+}
+
+// ReportCaseWarnModalSubmit warns the author of a reported message with the
+// reason the moderator gave
+func ReportCaseWarnModalSubmit(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	if i.Type != discordgo.InteractionModalSubmit {
+		return
+	}
+	data := i.ModalSubmitData()
+	if !strings.HasPrefix(data.CustomID, "reportcase_warnmodal_") {
+		return
+	}
+	id, err := strconv.Atoi(strings.TrimPrefix(data.CustomID, "reportcase_warnmodal_"))
+	if err != nil {
+		return
+	}
+
+	reportCase, ok := openCaseForModerator(s, i, id)
+	if !ok {
+		return
+	}
+	actOnReportCase(s, i, reportCase, "warn", modalTextValue(data, "reason"))
+}
+
+// openCaseForModerator loads a case for a moderator to act on, telling them
+// if they can't
+func openCaseForModerator(s *discordgo.Session, i *discordgo.InteractionCreate, id int) (*ReportCase, bool) {
+	reply := ""
+	reportCase, found := GetReportCase(id)
+	switch {
+	case !HasModeratorRole(i.Member):
+		reply = "You do not have permission to act on reports."
+	case !found || reportCase.Status != CaseOpen:
+		reply = "This case has already been closed."
+	default:
+		return reportCase, true
+	}
+
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Content: reply,
+			Flags:   discordgo.MessageFlagsEphemeral,
+		},
+	})
+	if err != nil {
+		log.Println("Error sending interaction response:", err)
+	}
+	return nil, false
+}
+
+// showWarnReasonModal asks the moderator why the author is being warned
+func showWarnReasonModal(s *discordgo.Session, i *discordgo.InteractionCreate, reportCase *ReportCase) {
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseModal,
+		Data: &discordgo.InteractionResponseData{
+			CustomID: fmt.Sprintf("reportcase_warnmodal_%d", reportCase.ID),
+			Title:    fmt.Sprintf("Warn for Case #%d", reportCase.ID),
+			Components: []discordgo.MessageComponent{
+				discordgo.ActionsRow{
+					Components: []discordgo.MessageComponent{
+						discordgo.TextInput{
+							CustomID:    "reason",
+							Label:       "Reason",
+							Style:       discordgo.TextInputParagraph,
+							Placeholder: "Sent to the author with the warning",
+							Required:    true,
+							MaxLength:   500,
+						},
+					},
+				},
+			},
+		},
+	})
+	if err != nil {
+		log.Println("Error sending warn reason modal:", err)
+	}
+}
+
+// actOnReportCase applies a moderator's action to a case and redraws the
+// case message
+func actOnReportCase(s *discordgo.Session, i *discordgo.InteractionCreate, reportCase *ReportCase, action, warnReason string) {
+	id := reportCase.ID
+	// Claim the case so two moderators pressing at once can't both act on
+	// it
+	err := storage.Update(reportCaseBucket, reportCaseKey(id), reportCase, func(found bool) error {
+		switch {
+		case !found || reportCase.Status != CaseOpen:
+			return errReportCaseClosed
+		case reportCase.Claimed:
+			return errReportCaseClaimed
+		}
+		reportCase.Claimed = true
+		return nil
+	})
+	if err != nil {
+		reply := "This case has already been closed."
+		switch {
+		case errors.Is(err, errReportCaseClaimed):
+			reply = "Another moderator is acting on this case, try again in a moment."
+		case !errors.Is(err, errReportCaseClosed):
+			log.Printf("Error claiming report case %d: %v", id, err)
+			reply = "Error reading the report case. Please try again later."
+		}
+		err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseChannelMessageWithSource,
+			Data: &discordgo.InteractionResponseData{
+				Content: reply,
+				Flags:   discordgo.MessageFlagsEphemeral,
+			},
+		})
+		if err != nil {
+			log.Println("Error sending interaction response:", err)
+		}
+		return
+	}
+
+	// Deleting, timing out and warning all call Discord, which can outlast
+	// the interaction deadline
+	err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseDeferredMessageUpdate,
+	})
+	if err != nil {
+		log.Println("Error sending interaction response:", err)
+	}
+
+	summary, actionErr := applyCaseAction(s, reportCase, action, i.Member, warnReason)
+	if actionErr != nil {
+		log.Printf("Error acting on report case %d: %v", id, actionErr)
+		releaseReportCase(id)
+		reportCaseFollowup(s, i, "Could not complete that action: "+actionErr.Error())
+		return
+	}
+
+	status := reportCase.Status
+	err = storage.Update(reportCaseBucket, reportCaseKey(id), reportCase, func(found bool) error {
+		if !found {
+			return fmt.Errorf("report case %d not found", id)
+		}
+		reportCase.Status = status
+		if summary != "" {
+			reportCase.Actions = append(reportCase.Actions, caseAction{Action: summary, By: i.Member.User.ID, At: time.Now()})
+		}
+		reportCase.Claimed = false
+		return nil
+	})
+	if err != nil {
+		log.Printf("Error updating report case: %v", err)
+		releaseReportCase(id)
+		reportCaseFollowup(s, i, "The action was taken, but the case could not be updated.")
+		return
+	}
+	if reportCase.Status != CaseOpen {
+		if err := storage.Delete(reportCaseIndexBucket, reportCase.MessageID); err != nil {
+			log.Printf("Error closing report case %d: %v", id, err)
+		}
+		go notifyReporters(s, reportCase)
+	}
+
+	embeds := []*discordgo.MessageEmbed{reportCase.embed()}
+	components := reportCase.components()
+	_, err = s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
+		Embeds:     &embeds,
+		Components: &components,
+	})
+	if err != nil {
+		log.Println("Error editing interaction response:", err)
+	}
+}
+
+// releaseReportCase drops a moderator's claim on a case so it can be acted
+// on again
+func releaseReportCase(id int) {
+	var reportCase ReportCase
+	err := storage.Update(reportCaseBucket, reportCaseKey(id), &reportCase, func(found bool) error {
+		if !found {
+			return fmt.Errorf("report case %d not found", id)
+		}
+		reportCase.Claimed = false
+		return nil
+	})
+	if err != nil {
+		log.Printf("Error releasing report case %d: %v", id, err)
+	}
+}
+
+// reportCaseFollowup tells the moderator why their deferred action failed
+func reportCaseFollowup(s *discordgo.Session, i *discordgo.InteractionCreate, content string) {
+	_, err := s.FollowupMessageCreate(i.Interaction, true, &discordgo.WebhookParams{
+		Content: content,
+		Flags:   discordgo.MessageFlagsEphemeral,
+	})
+	if err != nil {
+		log.Println("Error sending follow-up message:", err)
+	}
+}
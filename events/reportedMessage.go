@@ -1,12 +1,17 @@
 package events
 
 import (
+	"fmt"
 	"log"
+	"strings"
+
+	"djs-zth-utilities/storage"
 
 	"github.com/bwmarrin/discordgo"
-	"github.com/spf13/viper"
 )
 
+// HandleReportMessageCommand asks the reporter why they are reporting the
+// message before a case is opened
 func HandleReportMessageCommand(s *discordgo.Session, i *discordgo.InteractionCreate) {
 	if i.Type != discordgo.InteractionApplicationCommand {
 		return
@@ -15,33 +20,204 @@ func HandleReportMessageCommand(s *discordgo.Session, i *discordgo.InteractionCr
 	if data.Name != "Report Message" {
 		return
 	}
-	messageId := data.TargetID
-	channelId := i.ChannelID
-
-	moderatorRole := viper.GetString("moderatorRoleId")
-	modChannelId := viper.GetString("moderationChannelId")
-	messageLink := "https://discord.com/channels/" + i.GuildID + "/" + channelId + "/" + messageId
-
-	embed := &discordgo.MessageEmbed{
-		Title:       "Message Reported",
-		Description: "Message Reported: " + messageLink + " has been reported.",
-	}
 
-	_, err := s.ChannelMessageSendComplex(modChannelId, &discordgo.MessageSend{
-		Content: "<@&" + moderatorRole + ">",
-		Embeds:  []*discordgo.MessageEmbed{embed},
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseModal,
+		Data: &discordgo.InteractionResponseData{
+			CustomID: "report_modal_" + i.ChannelID + "_" + data.TargetID,
+			Title:    "Report Message",
+			Components: []discordgo.MessageComponent{
+				discordgo.ActionsRow{
+					Components: []discordgo.MessageComponent{
+						discordgo.TextInput{
+							CustomID:    "reason",
+							Label:       "Why are you reporting this message?",
+							Style:       discordgo.TextInputParagraph,
+							Placeholder: "Let the moderators know what's wrong",
+							Required:    true,
+							MaxLength:   500,
+						},
+					},
+				},
+			},
+		},
 	})
 	if err != nil {
-		log.Println("Error sending report message:", err)
+		log.Println("Error sending report modal:", err)
 	}
-	err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
-		Type: discordgo.InteractionResponseChannelMessageWithSource,
+}
+
+// HandleReportModalSubmit snapshots the reported message and opens a case
+// for moderators
+func HandleReportModalSubmit(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	if i.Type != discordgo.InteractionModalSubmit {
+		return
+	}
+	data := i.ModalSubmitData()
+	if !strings.HasPrefix(data.CustomID, "report_modal_") {
+		return
+	}
+	parts := strings.Split(data.CustomID, "_")
+	if len(parts) != 4 {
+		return
+	}
+	channelId, messageId := parts[2], parts[3]
+	reason := modalTextValue(data, "reason")
+
+	// Opening a case fetches the message and posts the case, which can
+	// outlast the interaction deadline
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
 		Data: &discordgo.InteractionResponseData{
-			Content: "Message has been reported.",
-			Flags:   discordgo.MessageFlagsEphemeral,
+			Flags: discordgo.MessageFlagsEphemeral,
 		},
 	})
 	if err != nil {
 		log.Println("Error sending interaction response:", err)
 	}
+
+	reply := fileReport(s, i.GuildID, channelId, messageId, i.Member.User.ID, reason)
+	_, err = s.FollowupMessageCreate(i.Interaction, true, &discordgo.WebhookParams{
+		Content: reply,
+		Flags:   discordgo.MessageFlagsEphemeral,
+	})
+	if err != nil {
+		log.Println("Error sending follow-up message:", err)
+	}
+}
+
+// fileReport adds a report to the message's open case, or opens one, and
+// returns the reply for the reporter
+func fileReport(s *discordgo.Session, guildId, channelId, messageId, reporterId, reason string) string {
+	// Held until the case is posted, so two reports of the same message
+	// can't both open a case and a failed post can be undone
+	defer reportLocks.lock(messageId)()
+
+	if existing, found := openCaseForMessage(messageId); found {
+		reportCase, added, err := addReport(existing.ID, reporterId, reason)
+		switch {
+		case err != nil:
+			log.Println("Error adding report to case:", err)
+			return "Error reporting the message. Please try again later."
+		case !added:
+			return fmt.Sprintf("You have already reported this message (case #%d).", reportCase.ID)
+		}
+		updateReportCase(s, reportCase)
+		return fmt.Sprintf("This message was already reported, your report has been added to case #%d. Thank you!", reportCase.ID)
+	}
+
+	msg, err := s.ChannelMessage(channelId, messageId)
+	if err != nil {
+		// The message may have been deleted since, fall back to the store
+		cached, found := messageCache.Get(messageId)
+		if !found {
+			log.Printf("Error fetching reported message %s: %v", messageId, err)
+			return "That message could not be found, it may have been deleted."
+		}
+		msg = cached
+	}
+	reportCase, err := openReportCase(guildId, msg, reporterId, reason)
+	if err != nil {
+		log.Println("Error opening report case:", err)
+		return "Error reporting the message. Please try again later."
+	}
+	if err := postReportCase(s, reportCase); err != nil {
+		log.Printf("Error sending report case %d: %v", reportCase.ID, err)
+		// Moderators never saw the case, so a later report should open
+		// a new one rather than be added to it
+		discardReportCase(reportCase)
+		return "Error reporting the message. Please try again later."
+	}
+	recordHistory(reportCase.AuthorID, HistoryReported, "<@"+reporterId+">", fmt.Sprintf("Message reported (case #%d): %s", reportCase.ID, reportCase.messageLink()))
+	return fmt.Sprintf("Message has been reported as case #%d. Thank you!", reportCase.ID)
+}
+
+// modalTextValue returns what was entered in a modal's text input
+func modalTextValue(data discordgo.ModalSubmitInteractionData, customID string) string {
+	for _, row := range data.Components {
+		if actionsRow, ok := row.(*discordgo.ActionsRow); ok {
+			for _, component := range actionsRow.Components {
+				if input, ok := component.(*discordgo.TextInput); ok && input.CustomID == customID {
+					return strings.TrimSpace(input.Value)
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// postReportCase sends a new case to the reports channel and remembers
+// where so it can be updated later
+func postReportCase(s *discordgo.Session, reportCase *ReportCase) error {
+	msg, err := sendAudit(s, AuditReports, reportCase.ChannelID, &discordgo.MessageSend{
+		Content:    reportPingContent(reportCase),
+		Embeds:     []*discordgo.MessageEmbed{reportCase.embed()},
+		Components: reportCase.components(),
+	})
+	if err != nil {
+		return err
+	}
+	err = storage.Update(reportCaseBucket, reportCaseKey(reportCase.ID), reportCase, func(found bool) error {
+		reportCase.AuditChannelID = msg.ChannelID
+		reportCase.AuditMessageID = msg.ID
+		return nil
+	})
+	if err != nil {
+		log.Printf("Error storing report case %d: %v", reportCase.ID, err)
+	}
+	return nil
+}
+
+// discardReportCase removes a case that could not be posted
+func discardReportCase(reportCase *ReportCase) {
+	if err := storage.Delete(reportCaseIndexBucket, reportCase.MessageID); err != nil {
+		log.Printf("Error removing report case %d: %v", reportCase.ID, err)
+	}
+	if err := storage.Delete(reportCaseBucket, reportCaseKey(reportCase.ID)); err != nil {
+		log.Printf("Error removing report case %d: %v", reportCase.ID, err)
+	}
+}
+
+// updateReportCase refreshes the case message after another member reports
+// the same message, pinging moderators again if a threshold was reached
+func updateReportCase(s *discordgo.Session, reportCase *ReportCase) {
+	if reportCase.AuditMessageID == "" {
+		// The case was never posted, post it now with every report so far
+		if err := postReportCase(s, reportCase); err != nil {
+			log.Printf("Error sending report case %d: %v", reportCase.ID, err)
+		}
+		return
+	}
+	refreshReportCase(s, reportCase)
+
+	if content := reportPingContent(reportCase); content != "" {
+		_, err := s.ChannelMessageSendComplex(reportCase.AuditChannelID, &discordgo.MessageSend{
+			Content: content,
+			Reference: &discordgo.MessageReference{
+				MessageID: reportCase.AuditMessageID,
+				ChannelID: reportCase.AuditChannelID,
+			},
+		})
+		if err != nil {
+			log.Printf("Error pinging moderators for case %d: %v", reportCase.ID, err)
+		}
+	}
+}
+
+// refreshReportCase redraws the case message from the stored case
+func refreshReportCase(s *discordgo.Session, reportCase *ReportCase) {
+	if reportCase.AuditMessageID == "" {
+		return
+	}
+	embeds := []*discordgo.MessageEmbed{reportCase.embed()}
+	components := reportCase.components()
+	_, err := s.ChannelMessageEditComplex(&discordgo.MessageEdit{
+		Channel:    reportCase.AuditChannelID,
+		ID:         reportCase.AuditMessageID,
+		Embeds:     &embeds,
+		Components: &components,
+	})
+	if err != nil {
+		log.Printf("Error updating report case %d: %v", reportCase.ID, err)
+	}
 }
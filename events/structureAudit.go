@@ -0,0 +1,428 @@
+package events
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/spf13/viper"
+)
+
+// permissionNames lists every permission bit in display order
+var permissionNames = []struct {
+	bit  int64
+	name string
+}{
+	{discordgo.PermissionAdministrator, "Administrator"},
+	{discordgo.PermissionManageGuild, "Manage Server"},
+	{discordgo.PermissionManageRoles, "Manage Roles"},
+	{discordgo.PermissionManageChannels, "Manage Channels"},
+	{discordgo.PermissionKickMembers, "Kick Members"},
+	{discordgo.PermissionBanMembers, "Ban Members"},
+	{discordgo.PermissionModerateMembers, "Timeout Members"},
+	{discordgo.PermissionViewAuditLogs, "View Audit Log"},
+	{discordgo.PermissionManageWebhooks, "Manage Webhooks"},
+	{discordgo.PermissionManageGuildExpressions, "Manage Expressions"},
+	{discordgo.PermissionManageEvents, "Manage Events"},
+	{discordgo.PermissionManageNicknames, "Manage Nicknames"},
+	{discordgo.PermissionManageMessages, "Manage Messages"},
+	{discordgo.PermissionManageThreads, "Manage Threads"},
+	{discordgo.PermissionMentionEveryone, "Mention Everyone"},
+	{discordgo.PermissionViewGuildInsights, "View Server Insights"},
+	{discordgo.PermissionViewCreatorMonetizationAnalytics, "View Monetization Analytics"},
+	{discordgo.PermissionCreateInstantInvite, "Create Invite"},
+	{discordgo.PermissionChangeNickname, "Change Nickname"},
+	{discordgo.PermissionViewChannel, "View Channels"},
+	{discordgo.PermissionSendMessages, "Send Messages"},
+	{discordgo.PermissionSendMessagesInThreads, "Send Messages in Threads"},
+	{discordgo.PermissionCreatePublicThreads, "Create Public Threads"},
+	{discordgo.PermissionCreatePrivateThreads, "Create Private Threads"},
+	{discordgo.PermissionSendTTSMessages, "Send TTS Messages"},
+	{discordgo.PermissionEmbedLinks, "Embed Links"},
+	{discordgo.PermissionAttachFiles, "Attach Files"},
+	{discordgo.PermissionReadMessageHistory, "Read Message History"},
+	{discordgo.PermissionAddReactions, "Add Reactions"},
+	{discordgo.PermissionUseExternalEmojis, "Use External Emojis"},
+	{discordgo.PermissionUseExternalStickers, "Use External Stickers"},
+	{discordgo.PermissionUseApplicationCommands, "Use Application Commands"},
+	{discordgo.PermissionUseExternalApps, "Use External Apps"},
+	{discordgo.PermissionSendVoiceMessages, "Send Voice Messages"},
+	{discordgo.PermissionSendPolls, "Create Polls"},
+	{discordgo.PermissionCreateGuildExpressions, "Create Expressions"},
+	{discordgo.PermissionCreateEvents, "Create Events"},
+	{discordgo.PermissionVoiceConnect, "Connect"},
+	{discordgo.PermissionVoiceSpeak, "Speak"},
+	{discordgo.PermissionVoiceStreamVideo, "Video"},
+	{discordgo.PermissionVoiceMuteMembers, "Mute Members"},
+	{discordgo.PermissionVoiceDeafenMembers, "Deafen Members"},
+	{discordgo.PermissionVoiceMoveMembers, "Move Members"},
+	{discordgo.PermissionVoiceUseVAD, "Use Voice Activity"},
+	{discordgo.PermissionVoicePrioritySpeaker, "Priority Speaker"},
+	{discordgo.PermissionVoiceRequestToSpeak, "Request to Speak"},
+	{discordgo.PermissionUseEmbeddedActivities, "Use Activities"},
+	{discordgo.PermissionUseSoundboard, "Use Soundboard"},
+	{discordgo.PermissionUseExternalSounds, "Use External Sounds"},
+}
+
+// dangerousPermissions trigger an alert when a role gains them
+const dangerousPermissions = discordgo.PermissionAdministrator | discordgo.PermissionManageRoles
+
+// Discord updates its state before handlers run, so the previous version
+// of each role is kept here to diff role updates and name deleted roles
+var (
+	roleSnapshots   = make(map[string]*discordgo.Role)
+	roleSnapshotsMu sync.Mutex
+)
+
+// SnapshotRoles records the guild's current roles
+func SnapshotRoles(s *discordgo.Session, guildId string) {
+	roles, err := s.GuildRoles(guildId)
+	if err != nil {
+		log.Printf("Error fetching roles: %v", err)
+		return
+	}
+	roleSnapshotsMu.Lock()
+	defer roleSnapshotsMu.Unlock()
+	for _, role := range roles {
+		roleSnapshots[role.ID] = role
+	}
+}
+
+// swapRoleSnapshot stores a role's new version and returns the previous one
+func swapRoleSnapshot(roleId string, role *discordgo.Role) *discordgo.Role {
+	roleSnapshotsMu.Lock()
+	defer roleSnapshotsMu.Unlock()
+	before := roleSnapshots[roleId]
+	if role == nil {
+		delete(roleSnapshots, roleId)
+	} else {
+		copied := *role
+		roleSnapshots[roleId] = &copied
+	}
+	return before
+}
+
+// permissionList decodes a permission bitfield into names
+func permissionList(permissions int64) []string {
+	var names []string
+	for _, permission := range permissionNames {
+		if permissions&permission.bit != 0 {
+			names = append(names, permission.name)
+		}
+	}
+	return names
+}
+
+func formatPermissions(permissions int64) string {
+	names := permissionList(permissions)
+	if len(names) == 0 {
+		return "None"
+	}
+	return strings.Join(names, ", ")
+}
+
+// permissionDiffFields lists the permissions gained and lost
+func permissionDiffFields(before, after int64) []*discordgo.MessageEmbedField {
+	var fields []*discordgo.MessageEmbedField
+	if gained := after &^ before; gained != 0 {
+		fields = append(fields, &discordgo.MessageEmbedField{
+			Name:  "Permissions Granted",
+			Value: TruncateText(formatPermissions(gained), embedFieldLimit),
+		})
+	}
+	if lost := before &^ after; lost != 0 {
+		fields = append(fields, &discordgo.MessageEmbedField{
+			Name:  "Permissions Revoked",
+			Value: TruncateText(formatPermissions(lost), embedFieldLimit),
+		})
+	}
+	return fields
+}
+
+func changeField(name, before, after string) *discordgo.MessageEmbedField {
+	return &discordgo.MessageEmbedField{
+		Name:  name,
+		Value: TruncateText(orNone(before)+" → "+orNone(after), embedFieldLimit),
+	}
+}
+
+func sendStructureAudit(s *discordgo.Session, embed *discordgo.MessageEmbed, content string) {
+	embed.Timestamp = time.Now().Format(time.RFC3339)
+	_, err := sendAudit(s, AuditServerChanges, "", &discordgo.MessageSend{
+		Content: content,
+		Embeds:  []*discordgo.MessageEmbed{embed},
+	})
+	if err != nil {
+		log.Printf("Error sending %s audit log: %v", strings.ToLower(embed.Title), err)
+	}
+}
+
+func channelTypeName(channelType discordgo.ChannelType) string {
+	switch channelType {
+	case discordgo.ChannelTypeGuildText:
+		return "Text"
+	case discordgo.ChannelTypeGuildVoice:
+		return "Voice"
+	case discordgo.ChannelTypeGuildCategory:
+		return "Category"
+	case discordgo.ChannelTypeGuildNews:
+		return "Announcement"
+	case discordgo.ChannelTypeGuildStageVoice:
+		return "Stage"
+	case discordgo.ChannelTypeGuildForum:
+		return "Forum"
+	case discordgo.ChannelTypeGuildMedia:
+		return "Media"
+	default:
+		return "Channel"
+	}
+}
+
+func overwriteTarget(overwrite *discordgo.PermissionOverwrite) string {
+	if overwrite.Type == discordgo.PermissionOverwriteTypeMember {
+		return "<@" + overwrite.ID + ">"
+	}
+	return "<@&" + overwrite.ID + ">"
+}
+
+func formatOverwrite(overwrite *discordgo.PermissionOverwrite) string {
+	return fmt.Sprintf("%s\nAllow: %s\nDeny: %s", overwriteTarget(overwrite), formatPermissions(overwrite.Allow), formatPermissions(overwrite.Deny))
+}
+
+// overwriteChanges describes added, removed and edited permission
+// overwrites, one entry per target
+func overwriteChanges(before, after []*discordgo.PermissionOverwrite) []string {
+	previous := make(map[string]*discordgo.PermissionOverwrite, len(before))
+	for _, overwrite := range before {
+		previous[overwrite.ID] = overwrite
+	}
+	var changes []string
+	for _, overwrite := range after {
+		old, exists := previous[overwrite.ID]
+		delete(previous, overwrite.ID)
+		if !exists {
+			changes = append(changes, "**Added** "+formatOverwrite(overwrite))
+			continue
+		}
+		if old.Allow == overwrite.Allow && old.Deny == overwrite.Deny {
+			continue
+		}
+		var lines []string
+		if gained := overwrite.Allow &^ old.Allow; gained != 0 {
+			lines = append(lines, "Now allowed: "+formatPermissions(gained))
+		}
+		if gained := overwrite.Deny &^ old.Deny; gained != 0 {
+			lines = append(lines, "Now denied: "+formatPermissions(gained))
+		}
+		if reset := (old.Allow | old.Deny) &^ (overwrite.Allow | overwrite.Deny); reset != 0 {
+			lines = append(lines, "Reset: "+formatPermissions(reset))
+		}
+		changes = append(changes, "**Changed** "+overwriteTarget(overwrite)+"\n"+strings.Join(lines, "\n"))
+	}
+	for _, overwrite := range before {
+		if _, removed := previous[overwrite.ID]; removed {
+			changes = append(changes, "**Removed** "+overwriteTarget(overwrite))
+		}
+	}
+	return changes
+}
+
+func OnChannelCreate(s *discordgo.Session, c *discordgo.ChannelCreate) {
+	if c.GuildID == "" {
+		return
+	}
+	embed := &discordgo.MessageEmbed{
+		Title: "Channel Created",
+		Color: 0x00FF00,
+		Fields: []*discordgo.MessageEmbedField{
+			{Name: "Channel", Value: "<#" + c.ID + "> (`" + c.Name + "`)", Inline: true},
+			{Name: "Type", Value: channelTypeName(c.Type), Inline: true},
+			{Name: "Created By", Value: recentAuditLogActor(s, c.GuildID, c.ID, "", discordgo.AuditLogActionChannelCreate), Inline: true},
+		},
+	}
+	if c.ParentID != "" {
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{Name: "Category", Value: "<#" + c.ParentID + ">", Inline: true})
+	}
+	if changes := overwriteChanges(nil, c.PermissionOverwrites); len(changes) > 0 {
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+			Name:  "Permission Overwrites",
+			Value: truncateList(changes, embedFieldLimit),
+		})
+	}
+	sendStructureAudit(s, embed, "")
+}
+
+func OnChannelUpdate(s *discordgo.Session, c *discordgo.ChannelUpdate) {
+	if c.GuildID == "" || c.BeforeUpdate == nil {
+		return
+	}
+	before, after := c.BeforeUpdate, c.Channel
+
+	var fields []*discordgo.MessageEmbedField
+	if before.Name != after.Name {
+		fields = append(fields, changeField("Name", before.Name, after.Name))
+	}
+	if before.Topic != after.Topic {
+		fields = append(fields, changeField("Topic", before.Topic, after.Topic))
+	}
+	if before.ParentID != after.ParentID {
+		fields = append(fields, changeField("Category", channelMention(before.ParentID), channelMention(after.ParentID)))
+	}
+	if before.NSFW != after.NSFW {
+		fields = append(fields, changeField("Age-Restricted", strconv.FormatBool(before.NSFW), strconv.FormatBool(after.NSFW)))
+	}
+	if before.RateLimitPerUser != after.RateLimitPerUser {
+		fields = append(fields, changeField("Slowmode", fmt.Sprintf("%ds", before.RateLimitPerUser), fmt.Sprintf("%ds", after.RateLimitPerUser)))
+	}
+	overwrites := overwriteChanges(before.PermissionOverwrites, after.PermissionOverwrites)
+	if len(overwrites) > 0 {
+		fields = append(fields, &discordgo.MessageEmbedField{
+			Name:  "Permission Overwrites",
+			Value: truncateList(overwrites, embedFieldLimit),
+		})
+	}
+	// Position changes of every other channel aren't worth an entry
+	if len(fields) == 0 {
+		return
+	}
+
+	action := discordgo.AuditLogActionChannelUpdate
+	if len(overwrites) > 0 && len(fields) == 1 {
+		action = discordgo.AuditLogActionChannelOverwriteUpdate
+	}
+	embed := &discordgo.MessageEmbed{
+		Title: "Channel Updated",
+		Color: 0x3498DB,
+		Fields: append([]*discordgo.MessageEmbedField{
+			{Name: "Channel", Value: "<#" + after.ID + "> (`" + after.Name + "`)", Inline: true},
+			{Name: "Updated By", Value: channelUpdateActor(s, after, action), Inline: true},
+		}, fields...),
+	}
+	sendStructureAudit(s, embed, "")
+}
+
+// channelUpdateActor checks the overwrite create, update and delete actions
+// when only the overwrites changed
+func channelUpdateActor(s *discordgo.Session, channel *discordgo.Channel, action discordgo.AuditLogAction) string {
+	if action != discordgo.AuditLogActionChannelOverwriteUpdate {
+		return recentAuditLogActor(s, channel.GuildID, channel.ID, "", action)
+	}
+	return recentAuditLogActor(s, channel.GuildID, channel.ID, "",
+		discordgo.AuditLogActionChannelOverwriteUpdate,
+		discordgo.AuditLogActionChannelOverwriteCreate,
+		discordgo.AuditLogActionChannelOverwriteDelete,
+	)
+}
+
+func OnChannelDelete(s *discordgo.Session, c *discordgo.ChannelDelete) {
+	if c.GuildID == "" {
+		return
+	}
+	embed := &discordgo.MessageEmbed{
+		Title: "Channel Deleted",
+		Color: 0xFF0000,
+		Fields: []*discordgo.MessageEmbedField{
+			{Name: "Channel", Value: "`" + c.Name + "` (" + c.ID + ")", Inline: true},
+			{Name: "Type", Value: channelTypeName(c.Type), Inline: true},
+			{Name: "Deleted By", Value: recentAuditLogActor(s, c.GuildID, c.ID, "", discordgo.AuditLogActionChannelDelete), Inline: true},
+		},
+	}
+	sendStructureAudit(s, embed, "")
+}
+
+func OnGuildRoleCreate(s *discordgo.Session, r *discordgo.GuildRoleCreate) {
+	swapRoleSnapshot(r.Role.ID, r.Role)
+	embed := &discordgo.MessageEmbed{
+		Title: "Role Created",
+		Color: 0x00FF00,
+		Fields: []*discordgo.MessageEmbedField{
+			{Name: "Role", Value: "<@&" + r.Role.ID + "> (`" + r.Role.Name + "`)", Inline: true},
+			{Name: "Created By", Value: recentAuditLogActor(s, r.GuildID, r.Role.ID, "", discordgo.AuditLogActionRoleCreate), Inline: true},
+			{Name: "Permissions", Value: TruncateText(formatPermissions(r.Role.Permissions), embedFieldLimit)},
+		},
+	}
+	sendStructureAudit(s, embed, dangerousPermissionAlert(embed, r.Role, 0, r.Role.Permissions))
+}
+
+func OnGuildRoleUpdate(s *discordgo.Session, r *discordgo.GuildRoleUpdate) {
+	before := swapRoleSnapshot(r.Role.ID, r.Role)
+	if before == nil {
+		log.Printf("No snapshot of role %s to compare against", r.Role.ID)
+		return
+	}
+	after := r.Role
+
+	var fields []*discordgo.MessageEmbedField
+	if before.Name != after.Name {
+		fields = append(fields, changeField("Name", before.Name, after.Name))
+	}
+	if before.Color != after.Color {
+		fields = append(fields, changeField("Color", fmt.Sprintf("#%06X", before.Color), fmt.Sprintf("#%06X", after.Color)))
+	}
+	if before.Hoist != after.Hoist {
+		fields = append(fields, changeField("Displayed Separately", strconv.FormatBool(before.Hoist), strconv.FormatBool(after.Hoist)))
+	}
+	if before.Mentionable != after.Mentionable {
+		fields = append(fields, changeField("Mentionable", strconv.FormatBool(before.Mentionable), strconv.FormatBool(after.Mentionable)))
+	}
+	fields = append(fields, permissionDiffFields(before.Permissions, after.Permissions)...)
+	// Position changes of every other role aren't worth an entry
+	if len(fields) == 0 {
+		return
+	}
+
+	embed := &discordgo.MessageEmbed{
+		Title: "Role Updated",
+		Color: 0x3498DB,
+		Fields: append([]*discordgo.MessageEmbedField{
+			{Name: "Role", Value: "<@&" + after.ID + "> (`" + after.Name + "`)", Inline: true},
+			{Name: "Updated By", Value: recentAuditLogActor(s, r.GuildID, after.ID, "", discordgo.AuditLogActionRoleUpdate), Inline: true},
+		}, fields...),
+	}
+	sendStructureAudit(s, embed, dangerousPermissionAlert(embed, after, before.Permissions, after.Permissions))
+}
+
+func OnGuildRoleDelete(s *discordgo.Session, r *discordgo.GuildRoleDelete) {
+	name := r.RoleID
+	if before := swapRoleSnapshot(r.RoleID, nil); before != nil {
+		name = before.Name
+	}
+	embed := &discordgo.MessageEmbed{
+		Title: "Role Deleted",
+		Color: 0xFF0000,
+		Fields: []*discordgo.MessageEmbedField{
+			{Name: "Role", Value: "`" + name + "` (" + r.RoleID + ")", Inline: true},
+			{Name: "Deleted By", Value: recentAuditLogActor(s, r.GuildID, r.RoleID, "", discordgo.AuditLogActionRoleDelete), Inline: true},
+		},
+	}
+	sendStructureAudit(s, embed, "")
+}
+
+// dangerousPermissionAlert flags a role that gained Administrator or
+// Manage Roles, returning the moderator ping to send with the entry
+func dangerousPermissionAlert(embed *discordgo.MessageEmbed, role *discordgo.Role, before, after int64) string {
+	gained := (after &^ before) & dangerousPermissions
+	if gained == 0 {
+		return ""
+	}
+	embed.Color = 0xFF0000
+	embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+		Name:  "🚨 Elevated Permissions",
+		Value: "<@&" + role.ID + "> gained " + formatPermissions(gained),
+	})
+	if moderatorRole := viper.GetString("moderatorRoleId"); moderatorRole != "" {
+		return "<@&" + moderatorRole + ">"
+	}
+	return ""
+}
+
+func channelMention(channelId string) string {
+	if channelId == "" {
+		return ""
+	}
+	return "<#" + channelId + ">"
+}
@@ -0,0 +1,270 @@
+package events
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"djs-zth-utilities/storage"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/spf13/viper"
+)
+
+const (
+	ticketBucket         = "tickets"
+	ticketReminderBucket = "ticketReminders"
+)
+
+var ticketInactivityOnce sync.Once
+
+// ticketRecord is stored for each ticket thread the bot processed
+type ticketRecord struct {
+	RequesterID string    `json:"requester_id"`
+	Name        string    `json:"name"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// ticketReminder is stored once the inactivity reminder has been sent
+type ticketReminder struct {
+	MessageID  string    `json:"message_id"`
+	RemindedAt time.Time `json:"reminded_at"`
+}
+
+// ticketThresholds are the inactivity thresholds for one ticket type
+type ticketThresholds struct {
+	Prefix        string  `mapstructure:"prefix"`
+	ReminderHours float64 `mapstructure:"reminderHours"`
+	CloseHours    float64 `mapstructure:"closeHours"`
+}
+
+func recordTicket(threadId, requesterId, name string) {
+	err := storage.Put(ticketBucket, threadId, ticketRecord{
+		RequesterID: requesterId,
+		Name:        name,
+		CreatedAt:   time.Now(),
+	})
+	if err != nil {
+		log.Printf("Error storing ticket %s: %v", threadId, err)
+	}
+	recordHistory(requesterId, HistoryTicket, "", "Opened ticket <#"+threadId+"> ("+name+")")
+}
+
+// ticketThresholdsFor returns the thresholds of the first ticket type in
+// ticketInactivity.types whose prefix matches the thread name, falling
+// back to ticketInactivity.default
+func ticketThresholdsFor(threadName string) ticketThresholds {
+	var types []ticketThresholds
+	if err := viper.UnmarshalKey("ticketInactivity.types", &types); err != nil {
+		log.Printf("Error reading ticketInactivity.types: %v", err)
+	}
+	for _, t := range types {
+		if t.Prefix != "" && strings.HasPrefix(strings.ToLower(threadName), strings.ToLower(t.Prefix)) {
+			return t
+		}
+	}
+	var fallback ticketThresholds
+	if err := viper.UnmarshalKey("ticketInactivity.default", &fallback); err != nil {
+		log.Printf("Error reading ticketInactivity.default: %v", err)
+	}
+	return fallback
+}
+
+// valid reports whether the thresholds leave time between the reminder and
+// closing the ticket
+func (t ticketThresholds) valid() bool {
+	return t.ReminderHours <= 0 || t.CloseHours <= 0 || t.CloseHours > t.ReminderHours
+}
+
+// ValidateTicketInactivity checks that every ticket type closes after its
+// reminder
+func ValidateTicketInactivity() error {
+	var types []ticketThresholds
+	if err := viper.UnmarshalKey("ticketInactivity.types", &types); err != nil {
+		return fmt.Errorf("invalid ticketInactivity.types: %w", err)
+	}
+	var fallback ticketThresholds
+	if err := viper.UnmarshalKey("ticketInactivity.default", &fallback); err != nil {
+		return fmt.Errorf("invalid ticketInactivity.default: %w", err)
+	}
+	for _, t := range append(types, fallback) {
+		if !t.valid() {
+			return fmt.Errorf("ticketInactivity closeHours (%v) must be greater than reminderHours (%v) for %q", t.CloseHours, t.ReminderHours, orNone(t.Prefix))
+		}
+	}
+	return nil
+}
+
+// StartTicketInactivityChecks checks open ticket threads every
+// ticketInactivity.checkIntervalMinutes for reminders and auto-closing
+func StartTicketInactivityChecks(s *discordgo.Session) {
+	ticketInactivityOnce.Do(func() {
+		minutes := viper.GetInt("ticketInactivity.checkIntervalMinutes")
+		if minutes <= 0 {
+			return
+		}
+		go func() {
+			ticker := time.NewTicker(time.Duration(minutes) * time.Minute)
+			defer ticker.Stop()
+			for range ticker.C {
+				checkTicketInactivity(s)
+			}
+		}()
+	})
+}
+
+func checkTicketInactivity(s *discordgo.Session) {
+	ticketChannelId := viper.GetString("ticketChannelId")
+	threads, err := s.GuildThreadsActive(viper.GetString("guildId"))
+	if err != nil {
+		log.Printf("Error fetching active threads: %v", err)
+		return
+	}
+	for _, thread := range threads.Threads {
+		if thread.ParentID != ticketChannelId {
+			continue
+		}
+		checkTicketThread(s, thread)
+	}
+}
+
+func checkTicketThread(s *discordgo.Session, thread *discordgo.Channel) {
+	thresholds := ticketThresholdsFor(thread.Name)
+	if thresholds.ReminderHours <= 0 && thresholds.CloseHours <= 0 {
+		return
+	}
+	if !thresholds.valid() {
+		// Only reachable if the config was reloaded, so skip closing rather
+		// than closing the ticket right after the reminder
+		log.Printf("ticketInactivity closeHours must be greater than reminderHours, not closing %s", thread.ID)
+		thresholds.CloseHours = 0
+	}
+
+	lastActivityID := thread.LastMessageID
+	if lastActivityID == "" {
+		lastActivityID = thread.ID
+	}
+	lastActivity, err := discordgo.SnowflakeTimestamp(lastActivityID)
+	if err != nil {
+		log.Printf("Error reading last activity for thread %s: %v", thread.ID, err)
+		return
+	}
+
+	var reminder ticketReminder
+	reminded, err := storage.Get(ticketReminderBucket, thread.ID, &reminder)
+	if err != nil {
+		log.Printf("Error reading reminder for thread %s: %v", thread.ID, err)
+		return
+	}
+	if reminded && thread.LastMessageID != reminder.MessageID {
+		// Someone has spoken since the reminder, start over
+		if err := storage.Delete(ticketReminderBucket, thread.ID); err != nil {
+			log.Printf("Error clearing reminder for thread %s: %v", thread.ID, err)
+		}
+		reminded = false
+	}
+
+	var ticket ticketRecord
+	if _, err := storage.Get(ticketBucket, thread.ID, &ticket); err != nil {
+		log.Printf("Error reading ticket %s: %v", thread.ID, err)
+	}
+
+	closeAfter := time.Duration(thresholds.CloseHours * float64(time.Hour))
+	reminderAfter := time.Duration(thresholds.ReminderHours * float64(time.Hour))
+
+	switch {
+	case closeAfter > 0 && reminded && time.Since(reminder.RemindedAt) >= closeAfter-reminderAfter:
+		closeInactiveTicket(s, thread, ticket, lastActivity)
+	case closeAfter > 0 && reminderAfter <= 0 && time.Since(lastActivity) >= closeAfter:
+		closeInactiveTicket(s, thread, ticket, lastActivity)
+	case reminderAfter > 0 && !reminded && time.Since(lastActivity) >= reminderAfter:
+		sendTicketReminder(s, thread, ticket, closeAfter-reminderAfter)
+	}
+}
+
+func sendTicketReminder(s *discordgo.Session, thread *discordgo.Channel, ticket ticketRecord, closesIn time.Duration) {
+	description := "This ticket has been quiet for a while. If you still need help, please reply here or hit the Ping Inviters button."
+	if closesIn > 0 {
+		description += " Otherwise it will be closed automatically <t:" + formatUnix(time.Now().Add(closesIn)) + ":R>."
+	}
+	embed := &discordgo.MessageEmbed{
+		Title:       "Are You Still There?",
+		Description: description,
+		Color:       0xFFA500,
+	}
+	content := ""
+	if ticket.RequesterID != "" {
+		content = "<@" + ticket.RequesterID + ">"
+	}
+	msg, err := s.ChannelMessageSendComplex(thread.ID, &discordgo.MessageSend{
+		Content: content,
+		Embeds:  []*discordgo.MessageEmbed{embed},
+	})
+	if err != nil {
+		log.Printf("Error sending reminder to thread %s: %v", thread.ID, err)
+		return
+	}
+	err = storage.Put(ticketReminderBucket, thread.ID, ticketReminder{
+		MessageID:  msg.ID,
+		RemindedAt: time.Now(),
+	})
+	if err != nil {
+		log.Printf("Error storing reminder for thread %s: %v", thread.ID, err)
+	}
+	log.Printf("Sent inactivity reminder to ticket %s", thread.ID)
+}
+
+func closeInactiveTicket(s *discordgo.Session, thread *discordgo.Channel, ticket ticketRecord, lastActivity time.Time) {
+	archived := true
+	_, err := s.ChannelEditComplex(thread.ID, &discordgo.ChannelEdit{
+		Archived: &archived,
+	})
+	if err != nil {
+		log.Printf("Error archiving thread %s: %v", thread.ID, err)
+		return
+	}
+	if err := storage.Delete(ticketReminderBucket, thread.ID); err != nil {
+		log.Printf("Error clearing reminder for thread %s: %v", thread.ID, err)
+	}
+	log.Printf("Auto-closed inactive ticket %s", thread.ID)
+	recordHistory(ticket.RequesterID, HistoryTicket, "", "Ticket <#"+thread.ID+"> closed for inactivity")
+
+	requester := "Unknown"
+	if ticket.RequesterID != "" {
+		requester = "<@" + ticket.RequesterID + ">"
+	}
+	embed := &discordgo.MessageEmbed{
+		Title: "Ticket Auto-Closed",
+		Color: 0x808080,
+		Fields: []*discordgo.MessageEmbedField{
+			{
+				Name:  "Ticket",
+				Value: "<#" + thread.ID + "> (" + thread.Name + ")",
+			},
+			{
+				Name:   "Requester",
+				Value:  requester,
+				Inline: true,
+			},
+			{
+				Name:   "Last Activity",
+				Value:  "<t:" + formatUnix(lastActivity) + ":f>",
+				Inline: true,
+			},
+		},
+	}
+	_, err = sendAudit(s, AuditTickets, thread.ID, &discordgo.MessageSend{
+		Embeds: []*discordgo.MessageEmbed{embed},
+	})
+	if err != nil {
+		log.Printf("Error sending ticket auto-close audit log: %v", err)
+	}
+}
+
+// formatUnix formats t as Unix seconds for Discord timestamp markup
+func formatUnix(t time.Time) string {
+	return strconv.FormatInt(t.Unix(), 10)
+}
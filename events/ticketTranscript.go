@@ -0,0 +1,233 @@
+package events
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/spf13/viper"
+)
+
+// transcriptLine is a single message in a JSONL transcript
+type transcriptLine struct {
+	ID          string   `json:"id"`
+	Timestamp   string   `json:"timestamp"`
+	AuthorID    string   `json:"author_id"`
+	Author      string   `json:"author"`
+	Bot         bool     `json:"bot"`
+	Content     string   `json:"content"`
+	Embeds      []string `json:"embeds,omitempty"`
+	Attachments []string `json:"attachments,omitempty"`
+}
+
+var transcriptTemplate = template.Must(template.New("transcript").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Name}} transcript</title>
+<style>
+body { font-family: sans-serif; background: #313338; color: #dbdee1; }
+.message { margin: 8px 0; }
+.author { font-weight: bold; color: #f2f3f5; }
+.time { color: #949ba4; font-size: 0.8em; margin-left: 6px; }
+.content { white-space: pre-wrap; }
+.embed { border-left: 4px solid #5865f2; background: #2b2d31; padding: 6px 10px; margin: 4px 0; white-space: pre-wrap; }
+a { color: #00a8fc; }
+</style>
+</head>
+<body>
+<h1>{{.Name}}</h1>
+<p>Thread ID {{.ID}} &middot; generated {{.Generated}}</p>
+{{range .Messages}}<div class="message">
+<span class="author">{{.Author}}</span><span class="time">{{.Timestamp}}</span>
+{{if .Content}}<div class="content">{{.Content}}</div>{{end}}
+{{range .Embeds}}<div class="embed">{{.}}</div>{{end}}
+{{range .Attachments}}<div><a href="{{.}}">{{.}}</a></div>{{end}}
+</div>
+{{end}}
+</body>
+</html>
+`))
+
+var unsafeFileChars = regexp.MustCompile(`[^a-zA-Z0-9_-]+`)
+
+// OnTicketThreadUpdate generates a transcript when a ticket thread under
+// ticketChannelId is archived or locked
+func OnTicketThreadUpdate(s *discordgo.Session, t *discordgo.ThreadUpdate) {
+	if t.ParentID != viper.GetString("ticketChannelId") || t.ThreadMetadata == nil {
+		return
+	}
+	closed := t.ThreadMetadata.Archived || t.ThreadMetadata.Locked
+	if !closed {
+		return
+	}
+	if t.BeforeUpdate != nil && t.BeforeUpdate.ThreadMetadata != nil &&
+		(t.BeforeUpdate.ThreadMetadata.Archived || t.BeforeUpdate.ThreadMetadata.Locked) {
+		// Already closed before this update, transcript was generated then
+		return
+	}
+
+	if _, err := PostTicketTranscript(s, t.Channel); err != nil {
+		log.Printf("Error generating transcript for thread %s: %v", t.ID, err)
+	}
+}
+
+// PostTicketTranscript writes HTML and JSONL transcripts of a thread to
+// transcriptDir and posts them to transcriptLogChannelId. It returns the
+// transcript message that was posted.
+func PostTicketTranscript(s *discordgo.Session, thread *discordgo.Channel) (*discordgo.Message, error) {
+	messages, err := fetchAllMessages(s, thread.ID)
+	if err != nil {
+		return nil, fmt.Errorf("fetching messages: %w", err)
+	}
+
+	lines := make([]transcriptLine, 0, len(messages))
+	for _, msg := range messages {
+		lines = append(lines, newTranscriptLine(msg))
+	}
+
+	var jsonl bytes.Buffer
+	encoder := json.NewEncoder(&jsonl)
+	for _, line := range lines {
+		if err := encoder.Encode(line); err != nil {
+			return nil, fmt.Errorf("encoding transcript line: %w", err)
+		}
+	}
+
+	var html bytes.Buffer
+	err = transcriptTemplate.Execute(&html, map[string]interface{}{
+		"Name":      thread.Name,
+		"ID":        thread.ID,
+		"Generated": time.Now().Format(time.RFC1123),
+		"Messages":  lines,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("rendering transcript: %w", err)
+	}
+
+	baseName := unsafeFileChars.ReplaceAllString(thread.Name, "_") + "-" + thread.ID
+	dir := viper.GetString("transcriptDir")
+	if dir == "" {
+		dir = "transcripts"
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("creating transcript directory: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, baseName+".html"), html.Bytes(), 0o644); err != nil {
+		return nil, fmt.Errorf("writing html transcript: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, baseName+".jsonl"), jsonl.Bytes(), 0o644); err != nil {
+		return nil, fmt.Errorf("writing jsonl transcript: %w", err)
+	}
+	log.Printf("Saved transcript for thread %s (%d messages)", thread.ID, len(lines))
+
+	logChannelId := viper.GetString("transcriptLogChannelId")
+	if logChannelId == "" {
+		return nil, nil
+	}
+
+	embed := &discordgo.MessageEmbed{
+		Title:     "Ticket Transcript",
+		Color:     0x5865F2,
+		Timestamp: time.Now().Format(time.RFC3339),
+		Fields: []*discordgo.MessageEmbedField{
+			{
+				Name:  "Thread",
+				Value: "<#" + thread.ID + "> (" + thread.Name + ")",
+			},
+			{
+				Name:   "Messages",
+				Value:  fmt.Sprintf("%d", len(lines)),
+				Inline: true,
+			},
+		},
+	}
+	return s.ChannelMessageSendComplex(logChannelId, &discordgo.MessageSend{
+		Embeds: []*discordgo.MessageEmbed{embed},
+		Files: []*discordgo.File{
+			{
+				Name:        baseName + ".html",
+				ContentType: "text/html",
+				Reader:      bytes.NewReader(html.Bytes()),
+			},
+			{
+				Name:        baseName + ".jsonl",
+				ContentType: "application/jsonl",
+				Reader:      bytes.NewReader(jsonl.Bytes()),
+			},
+		},
+	})
+}
+
+// fetchAllMessages pages through a channel's history and returns every
+// message oldest first
+func fetchAllMessages(s *discordgo.Session, channelId string) ([]*discordgo.Message, error) {
+	var all []*discordgo.Message
+	var beforeID string
+	for {
+		msgs, err := s.ChannelMessages(channelId, 100, beforeID, "", "")
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, msgs...)
+		if len(msgs) < 100 {
+			break
+		}
+		beforeID = msgs[len(msgs)-1].ID
+	}
+
+	// Discord returns newest first
+	for i, j := 0, len(all)-1; i < j; i, j = i+1, j-1 {
+		all[i], all[j] = all[j], all[i]
+	}
+	return all, nil
+}
+
+func newTranscriptLine(msg *discordgo.Message) transcriptLine {
+	line := transcriptLine{
+		ID:        msg.ID,
+		Timestamp: msg.Timestamp.Format(time.RFC3339),
+		Content:   msg.Content,
+	}
+	if msg.Author != nil {
+		line.AuthorID = msg.Author.ID
+		line.Author = msg.Author.Username
+		line.Bot = msg.Author.Bot
+	}
+	for _, embed := range msg.Embeds {
+		line.Embeds = append(line.Embeds, embedText(embed))
+	}
+	for _, attachment := range msg.Attachments {
+		line.Attachments = append(line.Attachments, attachment.URL)
+	}
+	return line
+}
+
+// embedText flattens an embed into plain text
+func embedText(embed *discordgo.MessageEmbed) string {
+	var parts []string
+	if embed.Title != "" {
+		parts = append(parts, embed.Title)
+	}
+	if embed.Description != "" {
+		parts = append(parts, embed.Description)
+	}
+	for _, field := range embed.Fields {
+		parts = append(parts, field.Name+": "+field.Value)
+	}
+	if embed.Footer != nil && embed.Footer.Text != "" {
+		parts = append(parts, embed.Footer.Text)
+	}
+	if embed.Image != nil && embed.Image.URL != "" {
+		parts = append(parts, embed.Image.URL)
+	}
+	return strings.Join(parts, "\n")
+}
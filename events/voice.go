@@ -0,0 +1,338 @@
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"djs-zth-utilities/storage"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/spf13/viper"
+)
+
+const (
+	voiceSessionBucket     = "voiceSessions"
+	openVoiceSessionBucket = "openVoiceSessions"
+)
+
+var (
+	// voiceMu serializes changes to open voice sessions
+	voiceMu               sync.Mutex
+	voiceSessionPurgeOnce sync.Once
+)
+
+// VoiceSession is a stretch of time a member spent in one voice channel.
+// Open sessions have a zero End.
+type VoiceSession struct {
+	UserID    string    `json:"user_id"`
+	ChannelID string    `json:"channel_id"`
+	Start     time.Time `json:"start"`
+	End       time.Time `json:"end,omitempty"`
+}
+
+// Duration returns how long the session lasted, up to now if it is open
+func (v VoiceSession) Duration() time.Duration {
+	if v.End.IsZero() {
+		return time.Since(v.Start)
+	}
+	return v.End.Sub(v.Start)
+}
+
+// VoiceStat is a member's total time in voice
+type VoiceStat struct {
+	UserID   string
+	Total    time.Duration
+	Sessions int
+}
+
+// voiceSessionKey groups sessions by channel, oldest first
+func voiceSessionKey(session VoiceSession) string {
+	return fmt.Sprintf("%s/%020d/%s", session.ChannelID, session.Start.UnixNano(), session.UserID)
+}
+
+// openVoiceSession starts tracking a member in a channel. The caller must
+// hold voiceMu.
+func openVoiceSession(userId, channelId string, start time.Time) {
+	err := storage.Put(openVoiceSessionBucket, userId, VoiceSession{
+		UserID:    userId,
+		ChannelID: channelId,
+		Start:     start,
+	})
+	if err != nil {
+		log.Printf("Error storing voice session for %s: %v", userId, err)
+	}
+}
+
+// closeVoiceSession ends a member's open session and stores it. The
+// caller must hold voiceMu.
+func closeVoiceSession(userId string, end time.Time) (VoiceSession, bool) {
+	var session VoiceSession
+	found, err := storage.Get(openVoiceSessionBucket, userId, &session)
+	if err != nil {
+		log.Printf("Error reading voice session for %s: %v", userId, err)
+	}
+	if !found {
+		return session, false
+	}
+	if end.Before(session.Start) {
+		end = session.Start
+	}
+	session.End = end
+	if err := storage.Put(voiceSessionBucket, voiceSessionKey(session), session); err != nil {
+		log.Printf("Error storing voice session for %s: %v", userId, err)
+	}
+	if err := storage.Delete(openVoiceSessionBucket, userId); err != nil {
+		log.Printf("Error removing voice session for %s: %v", userId, err)
+	}
+	return session, true
+}
+
+// OnVoiceGuildCreate reconciles open voice sessions with who is in voice
+// when the bot connects. Sessions of members who left while the bot was
+// offline are closed at the time it was last online.
+func OnVoiceGuildCreate(s *discordgo.Session, g *discordgo.GuildCreate) {
+	if g.ID != viper.GetString("guildID") {
+		return
+	}
+	inVoice := make(map[string]string, len(g.VoiceStates))
+	for _, state := range g.VoiceStates {
+		inVoice[state.UserID] = state.ChannelID
+	}
+	end := time.Now()
+	if lastSeen, found := lastOnline(); found {
+		end = lastSeen
+	}
+
+	voiceMu.Lock()
+	defer voiceMu.Unlock()
+	var stale []string
+	err := storage.ForEach(openVoiceSessionBucket, "", func(key string, value []byte) error {
+		var session VoiceSession
+		if err := json.Unmarshal(value, &session); err != nil || inVoice[key] != session.ChannelID {
+			stale = append(stale, key)
+			return nil
+		}
+		delete(inVoice, key)
+		return nil
+	})
+	if err != nil {
+		log.Printf("Error reading open voice sessions: %v", err)
+		return
+	}
+	for _, userId := range stale {
+		closeVoiceSession(userId, end)
+	}
+	for userId, channelId := range inVoice {
+		openVoiceSession(userId, channelId, time.Now())
+	}
+}
+
+func OnVoiceStateUpdate(s *discordgo.Session, v *discordgo.VoiceStateUpdate) {
+	if v.GuildID != viper.GetString("guildID") {
+		return
+	}
+	now := time.Now()
+
+	voiceMu.Lock()
+	var open VoiceSession
+	found, err := storage.Get(openVoiceSessionBucket, v.UserID, &open)
+	if err != nil {
+		log.Printf("Error reading voice session for %s: %v", v.UserID, err)
+	}
+	before := ""
+	if found {
+		before = open.ChannelID
+	} else if v.BeforeUpdate != nil {
+		before = v.BeforeUpdate.ChannelID
+	}
+	after := v.ChannelID
+	// Mute, deafen and stream changes don't move the member
+	if before == after {
+		voiceMu.Unlock()
+		return
+	}
+	var closed VoiceSession
+	if before != "" {
+		closed, found = closeVoiceSession(v.UserID, now)
+	}
+	if after != "" {
+		openVoiceSession(v.UserID, after, now)
+	}
+	voiceMu.Unlock()
+
+	ignored := viper.GetStringSlice("voiceAudit.ignoredChannelIds")
+	skip := func(channelId string) bool {
+		return channelId == "" || contains(ignored, channelId)
+	}
+	if !viper.GetBool("voiceAudit.enabled") || skip(before) && skip(after) {
+		return
+	}
+
+	embed := &discordgo.MessageEmbed{
+		Color:     0x1ABC9C,
+		Timestamp: now.Format(time.RFC3339),
+		Fields: []*discordgo.MessageEmbedField{
+			{Name: "User", Value: "<@" + v.UserID + ">", Inline: true},
+		},
+	}
+	switch {
+	case before == "":
+		embed.Title = "Joined Voice"
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{Name: "Channel", Value: "<#" + after + ">", Inline: true})
+	case after == "":
+		embed.Title = "Left Voice"
+		embed.Color = 0xE67E22
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{Name: "Channel", Value: "<#" + before + ">", Inline: true})
+	default:
+		embed.Title = "Moved Voice Channel"
+		embed.Color = 0x3498DB
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{Name: "Channel", Value: "<#" + before + "> → <#" + after + ">", Inline: true})
+	}
+	if before != "" && found {
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+			Name:   "Time in <#" + before + ">",
+			Value:  formatDuration(closed.Duration()),
+			Inline: true,
+		})
+	}
+
+	sourceChannel := after
+	if sourceChannel == "" {
+		sourceChannel = before
+	}
+	_, err = sendAudit(s, AuditVoice, sourceChannel, &discordgo.MessageSend{
+		Embeds: []*discordgo.MessageEmbed{embed},
+	})
+	if err != nil {
+		log.Printf("Error sending voice audit log: %v", err)
+	}
+}
+
+// purgeVoiceSessions removes sessions that ended more than
+// voiceAudit.retentionDays ago
+func purgeVoiceSessions() {
+	days := viper.GetInt("voiceAudit.retentionDays")
+	if days <= 0 {
+		return
+	}
+	cutoff := time.Now().AddDate(0, 0, -days)
+	removed, err := storage.DeleteWhere(voiceSessionBucket, func(key string, value []byte) bool {
+		var session VoiceSession
+		if err := json.Unmarshal(value, &session); err != nil {
+			return true
+		}
+		return session.End.Before(cutoff)
+	})
+	if err != nil {
+		log.Printf("Error purging voice sessions: %v", err)
+		return
+	}
+	if removed > 0 {
+		log.Printf("Purged %d expired voice sessions", removed)
+	}
+}
+
+// StartVoiceSessionPurge purges expired voice sessions every hour
+func StartVoiceSessionPurge() {
+	voiceSessionPurgeOnce.Do(func() {
+		go func() {
+			ticker := time.NewTicker(time.Hour)
+			defer ticker.Stop()
+			for ; true; <-ticker.C {
+				purgeVoiceSessions()
+			}
+		}()
+	})
+}
+
+// VoiceSessions returns sessions overlapping since, optionally only in one
+// channel, including sessions that are still open
+func VoiceSessions(channelId string, since time.Time) ([]VoiceSession, error) {
+	var sessions []VoiceSession
+	collect := func(key string, value []byte) error {
+		var session VoiceSession
+		if err := json.Unmarshal(value, &session); err != nil {
+			log.Printf("Error decoding voice session %s: %v", key, err)
+			return nil
+		}
+		if channelId != "" && session.ChannelID != channelId {
+			return nil
+		}
+		if !session.End.IsZero() && session.End.Before(since) {
+			return nil
+		}
+		if session.Start.Before(since) {
+			session.Start = since
+		}
+		sessions = append(sessions, session)
+		return nil
+	}
+
+	prefix := ""
+	if channelId != "" {
+		prefix = channelId + "/"
+	}
+	if err := storage.ForEach(voiceSessionBucket, prefix, collect); err != nil {
+		return nil, err
+	}
+	if err := storage.ForEach(openVoiceSessionBucket, "", collect); err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+// VoiceStats totals voice time per member since a time, optionally only in
+// one channel and only for the given members. Members with the most time
+// come first.
+func VoiceStats(channelId string, userIds []string, since time.Time) ([]VoiceStat, error) {
+	sessions, err := VoiceSessions(channelId, since)
+	if err != nil {
+		return nil, err
+	}
+	totals := make(map[string]*VoiceStat)
+	for _, session := range sessions {
+		if userIds != nil && !contains(userIds, session.UserID) {
+			continue
+		}
+		stat, exists := totals[session.UserID]
+		if !exists {
+			stat = &VoiceStat{UserID: session.UserID}
+			totals[session.UserID] = stat
+		}
+		stat.Total += session.Duration()
+		stat.Sessions++
+	}
+
+	stats := make([]VoiceStat, 0, len(totals))
+	for _, stat := range totals {
+		stats = append(stats, *stat)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].Total > stats[j].Total
+	})
+	return stats, nil
+}
+
+// formatDuration formats a duration as hours and minutes, e.g. "3h 05m"
+func formatDuration(d time.Duration) string {
+	d = d.Round(time.Minute)
+	hours := int(d.Hours())
+	minutes := int(d.Minutes()) % 60
+	if hours == 0 {
+		return fmt.Sprintf("%dm", minutes)
+	}
+	return fmt.Sprintf("%dh %02dm", hours, minutes)
+}
+
+// FormatVoiceStats renders voice totals one member per line
+func FormatVoiceStats(stats []VoiceStat) []string {
+	lines := make([]string, 0, len(stats))
+	for idx, stat := range stats {
+		lines = append(lines, fmt.Sprintf("%d. <@%s> %s (%s)", idx+1, stat.UserID, formatDuration(stat.Total), plural(stat.Sessions, "session")))
+	}
+	return lines
+}
@@ -6,6 +6,8 @@ import (
 	"strings"
 	"time"
 
+	"djs-zth-utilities/wow"
+
 	"github.com/bwmarrin/discordgo"
 	"github.com/spf13/viper"
 )
@@ -37,7 +39,6 @@ func createTicketEmbed(s *discordgo.Session, m *discordgo.Message, threadId stri
 	}
 
 	log.Printf("Processing embed with %d fields", len(embedWithInfo.Fields))
-	var characterName, realm, mainCharacter string
 
 	// Debug: print all fields
 	for i, field := range embedWithInfo.Fields {
@@ -46,25 +47,7 @@ func createTicketEmbed(s *discordgo.Session, m *discordgo.Message, threadId stri
 		}
 	}
 
-	for _, field := range embedWithInfo.Fields {
-		switch field.Name {
-		case "Character Name":
-			characterName = field.Value
-		case "Realm or Server":
-			realm = field.Value
-		case "Main Character":
-			mainCharacter = field.Value
-		// Add alternative field names in case they're different
-		case "Character":
-			if characterName == "" {
-				characterName = field.Value
-			}
-		case "Realm", "Server":
-			if realm == "" {
-				realm = field.Value
-			}
-		}
-	}
+	characterName, realm, mainCharacter := characterFromEmbedFields(embedWithInfo.Fields)
 
 	// Extract Discord nickname from thread messages
 	var discordNickname string
@@ -114,7 +97,7 @@ func createTicketEmbed(s *discordgo.Session, m *discordgo.Message, threadId stri
 			if discordNickname == "" && msg.Author.ID == userId {
 				// Try to get nickname from guild member first
 				if guildID != "" {
-					if member, err := s.GuildMember(guildID, userId); err == nil {
+					if member, err := GetMember(s, guildID, userId); err == nil {
 						log.Printf("Guild member lookup from user message - Nick: '%s', Username: '%s', GlobalName: '%s'",
 							member.Nick, member.User.Username, member.User.GlobalName)
 
@@ -143,7 +126,7 @@ func createTicketEmbed(s *discordgo.Session, m *discordgo.Message, threadId stri
 					if mention.ID == userId {
 						// Try guild member lookup with the guild ID we found
 						if guildID != "" {
-							if member, err := s.GuildMember(guildID, userId); err == nil {
+							if member, err := GetMember(s, guildID, userId); err == nil {
 								log.Printf("Guild member lookup from mention - Nick: '%s', Username: '%s', GlobalName: '%s'",
 									member.Nick, member.User.Username, member.User.GlobalName)
 
@@ -180,7 +163,7 @@ func createTicketEmbed(s *discordgo.Session, m *discordgo.Message, threadId stri
 
 	// Final fallback: try direct guild member lookup if we still don't have a nickname
 	if discordNickname == "" && guildID != "" {
-		if member, err := s.GuildMember(guildID, userId); err == nil {
+		if member, err := GetMember(s, guildID, userId); err == nil {
 			log.Printf("Guild member lookup successful (final fallback) - Nick: '%s', Username: '%s', GlobalName: '%s'",
 				member.Nick, member.User.Username, member.User.GlobalName)
 
@@ -203,12 +186,16 @@ func createTicketEmbed(s *discordgo.Session, m *discordgo.Message, threadId stri
 
 	// Check if user has a server nickname specifically
 	var hasServerNickname bool
+	var serverNickname string
 	if guildID != "" {
-		if member, err := s.GuildMember(guildID, userId); err == nil {
-			hasServerNickname = member.Nick != "" && strings.TrimSpace(member.Nick) != ""
+		if member, err := GetMember(s, guildID, userId); err == nil {
+			serverNickname = strings.TrimSpace(member.Nick)
+			hasServerNickname = serverNickname != ""
 		}
 	}
 
+	RecordMainCharacter(userId, mainCharacter, "ticket")
+
 	// Use main character as fallback if no Discord nickname found
 	guildNoteValue := "[XFa:" + mainCharacter + "]"
 	if discordNickname != "" {
@@ -240,6 +227,29 @@ func createTicketEmbed(s *discordgo.Session, m *discordgo.Message, threadId stri
 		}
 	}
 
+	// Send warning embed if the nickname doesn't match the main character
+	if hasServerNickname && mainCharacter != "" && !NicknameMatchesPolicy(serverNickname, wow.NormalizeCharacter(mainCharacter, "").Name) {
+		log.Println("Warning: User's server nickname does not match their main character")
+
+		roleApproverId := viper.GetString("roleApproverId")
+		if roleApproverId != "" {
+			warningEmbed := &discordgo.MessageEmbed{
+				Title:       "⚠️ Server Nickname Doesn't Match Main",
+				Description: "Nickname `" + serverNickname + "` does not match main character `" + mainCharacter + "`. The member can use `/setnick` to request a change.",
+				Color:       0xFFA500, // Orange color for warning
+				Timestamp:   time.Now().Format(time.RFC3339),
+			}
+
+			_, err := s.ChannelMessageSendComplex(threadId, &discordgo.MessageSend{
+				Content: "||<@&" + roleApproverId + ">||",
+				Embeds:  []*discordgo.MessageEmbed{warningEmbed},
+			})
+			if err != nil {
+				log.Printf("Error sending nickname mismatch embed: %v", err)
+			}
+		}
+	}
+
 	log.Printf("Extracted: Character='%s', Realm='%s', MainCharacter='%s', DiscordNickname='%s', UserID='%s'", characterName, realm, mainCharacter, discordNickname, userId)
 
 	if characterName == "" || realm == "" || userId == "" {
@@ -247,15 +257,12 @@ func createTicketEmbed(s *discordgo.Session, m *discordgo.Message, threadId stri
 		return
 	}
 
+	character := wow.NormalizeCharacter(characterName, realm)
+
 	// Send a message to the ticket thread
 	ticketEmbed := &discordgo.MessageEmbed{
 		Title: "Copy & Paste for Inviters",
-		Fields: []*discordgo.MessageEmbedField{
-			{
-				Name:   "Character",
-				Value:  characterName + "-" + realm,
-				Inline: false,
-			},
+		Fields: append(inviteEmbedFields(character), []*discordgo.MessageEmbedField{
 			{
 				Name:   "Guild Note",
 				Value:  guildNoteValue,
@@ -266,7 +273,7 @@ func createTicketEmbed(s *discordgo.Session, m *discordgo.Message, threadId stri
 				Value:  "`<@" + userId + ">`",
 				Inline: false,
 			},
-		},
+		}...),
 	}
 
 	_, err = s.ChannelMessageSendComplex(threadId, &discordgo.MessageSend{
@@ -303,75 +310,137 @@ func OnZthTicketCreate(s *discordgo.Session, t *discordgo.ThreadCreate) {
 	log.Printf("Thread created in channel %s, target channel %s", t.ParentID, ticketChannelId)
 
 	if t.ParentID == ticketChannelId {
-		mu.Lock()
-		defer mu.Unlock()
-
-		// Check if we've already processed this thread
-		if _, exists := processedThreads[t.ID]; exists {
-			log.Printf("Thread %s already processed, skipping", t.ID)
-			return
-		}
+		processZthTicket(s, t.Channel)
+	} else {
+		log.Printf("Thread created in different channel: %s (not %s)", t.ParentID, ticketChannelId)
+	}
+}
 
-		log.Printf("Processing new thread %s in ticket channel", t.ID)
+// processZthTicket posts the inviter summary for a new ticket thread
+// once, even if the thread event is delivered again or caught up after
+// a restart. Only this thread is locked while waiting for the ticket
+// bot's messages, so other thread events are not held up.
+func processZthTicket(s *discordgo.Session, thread *discordgo.Channel) {
+	unlock := lockThread(thread.ID)
+	defer unlock()
+
+	// Check if we've already processed this thread
+	if isProcessed("ticket", thread.ID) {
+		log.Printf("Thread %s already processed, skipping", thread.ID)
+		return
+	}
 
-		// Retry mechanism with increasing delays
-		maxRetries := 5
-		delays := []time.Duration{2 * time.Second, 3 * time.Second, 5 * time.Second, 8 * time.Second, 10 * time.Second}
+	log.Printf("Processing new thread %s in ticket channel", thread.ID)
 
-		var mentionUser *discordgo.User
-		var messageWithEmbeds *discordgo.Message
+	// Retry mechanism with increasing delays
+	maxRetries := 5
+	delays := []time.Duration{2 * time.Second, 3 * time.Second, 5 * time.Second, 8 * time.Second, 10 * time.Second}
 
-		for attempt := 0; attempt < maxRetries; attempt++ {
-			time.Sleep(delays[attempt])
+	var mentionUser *discordgo.User
+	var messageWithEmbeds *discordgo.Message
 
-			messages, err := s.ChannelMessages(t.ID, 100, "", "", "")
-			if err != nil {
-				log.Printf("Error fetching messages (attempt %d): %v", attempt+1, err)
-				continue
-			}
+	for attempt := 0; attempt < maxRetries; attempt++ {
+		time.Sleep(delays[attempt])
 
-			log.Printf("Attempt %d: Fetched %d messages from thread %s", attempt+1, len(messages), t.ID)
+		messages, err := s.ChannelMessages(thread.ID, 100, "", "", "")
+		if err != nil {
+			log.Printf("Error fetching messages (attempt %d): %v", attempt+1, err)
+			continue
+		}
 
-			// Find mentioned user if we haven't already
-			if mentionUser == nil {
-				for _, msg := range messages {
-					if msg == nil || msg.Author == nil {
-						continue
-					}
-					if len(msg.Mentions) > 0 && msg.Mentions[0] != nil {
-						mentionUser = msg.Mentions[0]
-						log.Printf("Mentioned user: %s", mentionUser.ID)
-						break
-					}
-				}
-			}
+		log.Printf("Attempt %d: Fetched %d messages from thread %s", attempt+1, len(messages), thread.ID)
 
-			// Look for message with embeds
+		// Find mentioned user if we haven't already
+		if mentionUser == nil {
 			for _, msg := range messages {
-				if msg != nil && len(msg.Embeds) >= 2 {
-					messageWithEmbeds = msg
-					log.Printf("Found message with %d embeds on attempt %d", len(msg.Embeds), attempt+1)
+				if msg == nil || msg.Author == nil {
+					continue
+				}
+				if len(msg.Mentions) > 0 && msg.Mentions[0] != nil {
+					mentionUser = msg.Mentions[0]
+					log.Printf("Mentioned user: %s", mentionUser.ID)
 					break
 				}
 			}
+		}
 
-			// If we have both user and embeds, we can proceed
-			if mentionUser != nil && messageWithEmbeds != nil {
-				log.Println("Creating ticket embed")
-				createTicketEmbed(s, messageWithEmbeds, t.ID, mentionUser.ID)
-				processedThreads[t.ID] = true
-				return
+		// Look for message with embeds
+		for _, msg := range messages {
+			if msg != nil && len(msg.Embeds) >= 2 {
+				messageWithEmbeds = msg
+				log.Printf("Found message with %d embeds on attempt %d", len(msg.Embeds), attempt+1)
+				break
 			}
+		}
 
-			log.Printf("Attempt %d: mentionUser=%v, messageWithEmbeds=%v", attempt+1, mentionUser != nil, messageWithEmbeds != nil)
+		// If we have both user and embeds, we can proceed
+		if mentionUser != nil && messageWithEmbeds != nil {
+			log.Println("Creating ticket embed")
+			createTicketEmbed(s, messageWithEmbeds, thread.ID, mentionUser.ID)
+			recordTicket(thread.ID, mentionUser.ID, thread.Name)
+			markProcessed("ticket", thread.ID)
+			return
 		}
 
-		if mentionUser == nil {
-			log.Println("No mentioned user found after all retries")
-		} else if messageWithEmbeds == nil {
-			log.Println("No message with sufficient embeds found after all retries")
+		log.Printf("Attempt %d: mentionUser=%v, messageWithEmbeds=%v", attempt+1, mentionUser != nil, messageWithEmbeds != nil)
+	}
+
+	if mentionUser == nil {
+		log.Println("No mentioned user found after all retries")
+	} else if messageWithEmbeds == nil {
+		log.Println("No message with sufficient embeds found after all retries")
+	}
+}
+
+// characterFromEmbedFields pulls the character name, realm and main
+// character out of an application or ticket form embed
+func characterFromEmbedFields(fields []*discordgo.MessageEmbedField) (characterName, realm, mainCharacter string) {
+	for _, field := range fields {
+		if field == nil {
+			continue
 		}
-	} else {
-		log.Printf("Thread created in different channel: %s (not %s)", t.ParentID, ticketChannelId)
+		switch field.Name {
+		case "Character Name":
+			characterName = field.Value
+		case "Realm or Server":
+			realm = field.Value
+		case "Main Character":
+			mainCharacter = field.Value
+		// Add alternative field names in case they're different
+		case "Character":
+			if characterName == "" {
+				characterName = field.Value
+			}
+		case "Realm", "Server":
+			if realm == "" {
+				realm = field.Value
+			}
+		}
+	}
+	return characterName, realm, mainCharacter
+}
+
+// inviteEmbedFields builds the copy/paste fields inviters use in game,
+// flagging realms that aren't in the retail realm list
+func inviteEmbedFields(character wow.Character) []*discordgo.MessageEmbedField {
+	fields := []*discordgo.MessageEmbedField{
+		{
+			Name:   "Character",
+			Value:  character.FullName(),
+			Inline: false,
+		},
+		{
+			Name:   "Invite Command",
+			Value:  "`" + character.InviteCommand() + "`",
+			Inline: false,
+		},
+	}
+	if !character.KnownRealm {
+		fields = append(fields, &discordgo.MessageEmbedField{
+			Name:   "⚠️ Unknown Realm",
+			Value:  "`" + character.Realm + "` is not a known retail realm, please double check it with the member",
+			Inline: false,
+		})
 	}
+	return fields
 }
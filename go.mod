@@ -6,8 +6,8 @@ toolchain go1.24.1
 
 require (
 	github.com/bwmarrin/discordgo v0.29.0
-	github.com/hashicorp/golang-lru v1.0.2
 	github.com/spf13/viper v1.21.0
+	go.etcd.io/bbolt v1.4.3
 )
 
 require (
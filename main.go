@@ -4,11 +4,13 @@ import (
 	"djs-zth-utilities/commands"
 	"djs-zth-utilities/events"
 	"djs-zth-utilities/posts"
+	"djs-zth-utilities/storage"
 	"fmt"
 	"log"
 	"os"
 	"os/signal"
 	"sync"
+	_ "time/tzdata"
 
 	"github.com/bwmarrin/discordgo"
 	"github.com/spf13/viper"
@@ -31,6 +33,11 @@ func onReady(s *discordgo.Session, event *discordgo.Ready) {
 		events.CacheGuildMembers(s, guild.ID)
 	}()
 	events.RegisterCommands(s)
+	events.SnapshotRoles(s, guild.ID)
+	events.ReportConfigChanges(s)
+	if viper.GetBool("joinAudit.trackInvites") {
+		events.SnapshotInvites(s, guild.ID)
+	}
 
 	// Post the role selection embed
 	err = posts.PostRoleSelectionEmbed(s)
@@ -51,6 +58,14 @@ func onReady(s *discordgo.Session, event *discordgo.Ready) {
 	}
 	// Set up embed remover
 	posts.EmbedRemover(s)
+
+	events.StartEventLedger(s)
+	events.StartNicknameReport(s)
+	events.StartTicketInactivityChecks(s)
+	events.StartAttachmentCleanup()
+	events.StartMessageStorePurge()
+	events.StartVoiceSessionPurge()
+	events.StartRaidAttendance(s)
 }
 
 func main() {
@@ -62,8 +77,27 @@ func main() {
 	if err != nil {
 		log.Fatalf("Error reading config file: %s", err)
 	}
+	if err := events.ValidateNicknamePolicy(); err != nil {
+		log.Fatalf("Error in config file: %s", err)
+	}
+	if err := events.ValidateTicketInactivity(); err != nil {
+		log.Fatalf("Error in config file: %s", err)
+	}
+	if err := events.ValidateMessageStore(); err != nil {
+		log.Fatalf("Error in config file: %s", err)
+	}
+
+	databaseFile := viper.GetString("databaseFile")
+	if databaseFile == "" {
+		databaseFile = "data/bot.db"
+	}
+	err = storage.Open(databaseFile)
+	if err != nil {
+		log.Fatalf("Error opening database: %s", err)
+	}
+	defer storage.Close()
 
-	intents := discordgo.IntentsGuildMembers | discordgo.IntentsGuildMessages | discordgo.IntentsGuildMessageReactions | discordgo.IntentsGuildMessageTyping | discordgo.IntentsGuilds | discordgo.IntentsGuildVoiceStates | discordgo.IntentsDirectMessages | discordgo.IntentsDirectMessageReactions | discordgo.IntentsDirectMessageTyping
+	intents := discordgo.IntentsGuildMembers | discordgo.IntentsGuildMessages | discordgo.IntentsGuildMessageReactions | discordgo.IntentsGuildMessageTyping | discordgo.IntentsGuilds | discordgo.IntentsGuildVoiceStates | discordgo.IntentsGuildInvites | discordgo.IntentGuildModeration | discordgo.IntentsDirectMessages | discordgo.IntentsDirectMessageReactions | discordgo.IntentsDirectMessageTyping
 
 	discord, err := discordgo.New("Bot " + viper.GetString("botToken"))
 	if err != nil {
@@ -79,14 +113,48 @@ func main() {
 	discord.AddHandler(commands.Suggestion)
 	discord.AddHandler(commands.CreateRaidTeamInfo)
 	discord.AddHandler(commands.UpdateRaidTeamInfo)
+	discord.AddHandler(commands.Transcript)
+	discord.AddHandler(commands.SetNick)
+	discord.AddHandler(commands.History)
+	discord.AddHandler(commands.HistoryPageInteraction)
+	discord.AddHandler(commands.VoiceStats)
+	discord.AddHandler(commands.Attendance)
+	discord.AddHandler(commands.Warn)
+	discord.AddHandler(commands.Infractions)
+	discord.AddHandler(commands.Pardon)
+	discord.AddHandler(commands.Timeout)
+	discord.AddHandler(commands.Kick)
+	discord.AddHandler(commands.Ban)
 	discord.AddHandler(events.RoleButtonInteractionCreate)
+	discord.AddHandler(events.NicknameButtonInteractionCreate)
+	discord.AddHandler(events.LeaveChecklistInteractionCreate)
+	discord.AddHandler(events.RestoreRolesInteractionCreate)
 	discord.AddHandler(events.HandleReportMessageCommand)
+	discord.AddHandler(events.HandleReportModalSubmit)
+	discord.AddHandler(events.ReportCaseInteractionCreate)
+	discord.AddHandler(events.ReportCaseWarnModalSubmit)
+	discord.AddHandler(events.BanButtonInteractionCreate)
 	discord.AddHandler(events.OnDJsThreadCreate)
 	discord.AddHandler(events.OnZthTicketCreate)
+	discord.AddHandler(events.OnTicketThreadUpdate)
+	discord.AddHandler(events.OnGuildMembersChunk)
 	discord.AddHandler(events.OnMemberJoin)
 	discord.AddHandler(events.OnMemberLeave)
+	discord.AddHandler(events.OnInviteCreate)
+	discord.AddHandler(events.OnInviteDelete)
 	discord.AddHandler(events.OnMemberUpdate)
+	discord.AddHandler(events.OnAuditLogEntryCreate)
+	discord.AddHandler(events.OnChannelCreate)
+	discord.AddHandler(events.OnChannelUpdate)
+	discord.AddHandler(events.OnChannelDelete)
+	discord.AddHandler(events.OnGuildRoleCreate)
+	discord.AddHandler(events.OnGuildRoleUpdate)
+	discord.AddHandler(events.OnGuildRoleDelete)
+	discord.AddHandler(events.OnVoiceGuildCreate)
+	discord.AddHandler(events.OnVoiceStateUpdate)
+	discord.AddHandler(events.OnDisconnect)
 	discord.AddHandler(events.OnMessageDelete)
+	discord.AddHandler(events.OnMessageDeleteBulk)
 	discord.AddHandler(events.OnMessageCreate)
 	discord.AddHandler(events.OnMessageUpdate)
 	discord.AddHandler(posts.HandleRoleSelection)
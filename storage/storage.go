@@ -0,0 +1,198 @@
+// Package storage persists bot state in a single bbolt database file.
+// Values are stored as JSON under a bucket and key.
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var db *bolt.DB
+
+// ErrNotOpen is returned when the database is used before Open
+var ErrNotOpen = errors.New("storage: database is not open")
+
+// Open opens the database at path, creating it and its directory if needed
+func Open(path string) error {
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return err
+		}
+	}
+	var err error
+	db, err = bolt.Open(path, 0o600, &bolt.Options{Timeout: 5 * time.Second})
+	return err
+}
+
+// Close closes the database
+func Close() error {
+	if db == nil {
+		return nil
+	}
+	return db.Close()
+}
+
+// Put stores value as JSON under key in bucket
+func Put(bucket, key string, value interface{}) error {
+	if db == nil {
+		return ErrNotOpen
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(bucket))
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(key), data)
+	})
+}
+
+// PutBatch is Put for frequent writes. Concurrent calls are combined into
+// a single transaction, at the cost of waiting up to bbolt's batch delay.
+func PutBatch(bucket, key string, value interface{}) error {
+	if db == nil {
+		return ErrNotOpen
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return db.Batch(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(bucket))
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(key), data)
+	})
+}
+
+// Get decodes the value under key in bucket into value and reports
+// whether it was found
+func Get(bucket, key string, value interface{}) (bool, error) {
+	if db == nil {
+		return false, ErrNotOpen
+	}
+	var data []byte
+	err := db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(bucket))
+		if b == nil {
+			return nil
+		}
+		if v := b.Get([]byte(key)); v != nil {
+			data = append([]byte(nil), v...)
+		}
+		return nil
+	})
+	if err != nil || data == nil {
+		return false, err
+	}
+	return true, json.Unmarshal(data, value)
+}
+
+// Update loads the value under key into value, calls fn and stores value
+// back in a single transaction. found reports whether the key existed.
+// If fn returns an error nothing is written.
+func Update(bucket, key string, value interface{}, fn func(found bool) error) error {
+	if db == nil {
+		return ErrNotOpen
+	}
+	return db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(bucket))
+		if err != nil {
+			return err
+		}
+		found := false
+		if v := b.Get([]byte(key)); v != nil {
+			found = true
+			if err := json.Unmarshal(v, value); err != nil {
+				return err
+			}
+		}
+		if err := fn(found); err != nil {
+			return err
+		}
+		data, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(key), data)
+	})
+}
+
+// Delete removes key from bucket
+func Delete(bucket, key string) error {
+	if db == nil {
+		return ErrNotOpen
+	}
+	return db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(bucket))
+		if b == nil {
+			return nil
+		}
+		return b.Delete([]byte(key))
+	})
+}
+
+// ForEach calls fn for every key in bucket whose key starts with prefix,
+// in key order. An empty prefix visits the whole bucket.
+func ForEach(bucket, prefix string, fn func(key string, value []byte) error) error {
+	if db == nil {
+		return ErrNotOpen
+	}
+	return db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(bucket))
+		if b == nil {
+			return nil
+		}
+		c := b.Cursor()
+		for k, v := c.Seek([]byte(prefix)); k != nil && strings.HasPrefix(string(k), prefix); k, v = c.Next() {
+			if err := fn(string(k), v); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// DeleteWhere removes every key in bucket for which fn returns true and
+// returns how many keys were removed
+func DeleteWhere(bucket string, fn func(key string, value []byte) bool) (int, error) {
+	if db == nil {
+		return 0, ErrNotOpen
+	}
+	removed := 0
+	err := db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(bucket))
+		if b == nil {
+			return nil
+		}
+		// Collect keys first, deleting while iterating skips entries
+		var keys [][]byte
+		err := b.ForEach(func(k, v []byte) error {
+			if fn(string(k), v) {
+				keys = append(keys, append([]byte(nil), k...))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, k := range keys {
+			if err := b.Delete(k); err != nil {
+				return err
+			}
+		}
+		removed = len(keys)
+		return nil
+	})
+	return removed, err
+}
@@ -0,0 +1,120 @@
+package wow
+
+import (
+	_ "embed"
+	"strings"
+	"unicode"
+)
+
+//go:embed realms.txt
+var realmList string
+
+// realmsBySlug maps a realm slug (lowercase, no spaces, hyphens or
+// apostrophes) to the realm's display name as listed in realms.txt
+var realmsBySlug = loadRealms(realmList)
+
+func loadRealms(list string) map[string]string {
+	realms := make(map[string]string)
+	for _, line := range strings.Split(list, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		realms[RealmSlug(line)] = line
+	}
+	return realms
+}
+
+// Character holds a normalized character name and realm
+type Character struct {
+	Name string
+	// Realm is the realm's display name, e.g. "Area 52"
+	Realm string
+	// KnownRealm is false when the realm could not be found in the
+	// retail realm list
+	KnownRealm bool
+}
+
+// RealmSlug strips whitespace, hyphens and apostrophes from a realm name
+// and lowercases it so differently typed realm names can be compared
+func RealmSlug(realm string) string {
+	var b strings.Builder
+	for _, r := range realm {
+		if unicode.IsSpace(r) || r == '-' || r == '\'' || r == '’' {
+			continue
+		}
+		b.WriteRune(unicode.ToLower(r))
+	}
+	return b.String()
+}
+
+// NormalizeRealm returns the realm's display name from the retail realm
+// list. If the realm is unknown it is returned trimmed and title-cased
+// with ok set to false.
+func NormalizeRealm(realm string) (name string, ok bool) {
+	if known, exists := realmsBySlug[RealmSlug(realm)]; exists {
+		return known, true
+	}
+	words := strings.Fields(realm)
+	for i, word := range words {
+		words[i] = capitalize(word)
+	}
+	return strings.Join(words, " "), false
+}
+
+// NormalizeCharacterName strips whitespace from a character name and
+// applies WoW's capitalization (first letter upper, the rest lower)
+func NormalizeCharacterName(name string) string {
+	return capitalize(strings.Join(strings.Fields(name), ""))
+}
+
+// NormalizeCharacter normalizes a character name and realm as typed by a
+// member. The realm may also be given as part of the name ("Name-Realm").
+func NormalizeCharacter(name, realm string) Character {
+	name = strings.TrimSpace(name)
+	if realm == "" {
+		if idx := strings.Index(name, "-"); idx != -1 {
+			name, realm = name[:idx], name[idx+1:]
+		}
+	}
+	realmName, ok := NormalizeRealm(realm)
+	return Character{
+		Name:       NormalizeCharacterName(name),
+		Realm:      realmName,
+		KnownRealm: ok,
+	}
+}
+
+// FullName returns the character as "Name-Realm" using the in-game realm
+// format, which drops spaces and hyphens from the realm name
+func (c Character) FullName() string {
+	return c.Name + "-" + GameRealmName(c.Realm)
+}
+
+// InviteCommand returns the exact guild invite command for the character
+func (c Character) InviteCommand() string {
+	return "/ginvite " + c.FullName()
+}
+
+// GameRealmName converts a realm display name to the form the game uses
+// in "Name-Realm" strings, e.g. "Area 52" becomes "Area52" and
+// "Azjol-Nerub" becomes "AzjolNerub"
+func GameRealmName(realm string) string {
+	var b strings.Builder
+	for _, r := range realm {
+		if unicode.IsSpace(r) || r == '-' {
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func capitalize(word string) string {
+	runes := []rune(strings.ToLower(word))
+	if len(runes) == 0 {
+		return ""
+	}
+	runes[0] = unicode.ToUpper(runes[0])
+	return string(runes)
+}